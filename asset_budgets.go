@@ -0,0 +1,264 @@
+package railsassets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// AssetBudgetsConfigPath is the path, relative to the working directory, of
+// the file that defines asset size budgets.
+var AssetBudgetsConfigPath = filepath.Join("config", "asset_budgets.yml")
+
+// AssetBudget limits the size of the compiled assets that match a pattern.
+type AssetBudget struct {
+	// Pattern is matched against the file name of each compiled asset and
+	// against its logical path.
+	Pattern string
+
+	// MaxBytes is the largest size that is allowed.
+	MaxBytes int64
+
+	// Total applies the limit to the combined size of all matching assets
+	// instead of to each of them.
+	Total bool
+
+	// Compressed applies the limit to the gzip compressed size.
+	Compressed bool
+
+	// Source is where the budget was defined.
+	Source string
+}
+
+// String describes the assets that the budget applies to, such as
+// "total *.css (gzip)".
+func (b AssetBudget) String() string {
+	var description strings.Builder
+	if b.Total {
+		description.WriteString("total ")
+	}
+	description.WriteString(b.Pattern)
+	if b.Compressed {
+		description.WriteString(" (gzip)")
+	}
+	return description.String()
+}
+
+// BudgetViolation is an asset, or for a total budget a group of assets, that
+// is larger than its budget allows.
+type BudgetViolation struct {
+	Budget AssetBudget
+	Asset  string
+	Bytes  int64
+}
+
+var (
+	budgetRe = regexp.MustCompile(`^(total\s+)?(\S+)\s*<=\s*([0-9.]+\s*(?:[KMG]i?B|B)?)(?:\s+(gzip|raw))?$`)
+	sizeRe   = regexp.MustCompile(`^\s*([0-9.]+)\s*([KMG]i?B|B)?\s*$`)
+)
+
+// ParseAssetBudgets reads the asset size budgets from config/asset_budgets.yml
+// and from $BP_RAILS_ASSETS_BUDGETS. The variable holds budgets separated by
+// ";", each written as "[total ]<pattern> <= <size>[ gzip|raw]", for example
+// "application-*.js <= 300KB gzip; total *.css <= 150KB".
+func ParseAssetBudgets(workingDir string) ([]AssetBudget, error) {
+	var budgets []AssetBudget
+
+	content, err := os.ReadFile(filepath.Join(workingDir, AssetBudgetsConfigPath))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", AssetBudgetsConfigPath, err)
+	}
+
+	if err == nil {
+		var config struct {
+			Budgets []struct {
+				Pattern     string `yaml:"pattern"`
+				Max         string `yaml:"max"`
+				Total       bool   `yaml:"total"`
+				Compression string `yaml:"compression"`
+			} `yaml:"budgets"`
+		}
+
+		err = yaml.Unmarshal(content, &config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", AssetBudgetsConfigPath, err)
+		}
+
+		for i, entry := range config.Budgets {
+			budget, err := newAssetBudget(entry.Pattern, entry.Max, entry.Total, entry.Compression)
+			if err != nil {
+				return nil, fmt.Errorf("invalid budget %d in %s: %w", i+1, AssetBudgetsConfigPath, err)
+			}
+
+			budget.Source = AssetBudgetsConfigPath
+			budgets = append(budgets, budget)
+		}
+	}
+
+	for _, entry := range strings.Split(os.Getenv("BP_RAILS_ASSETS_BUDGETS"), ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		matches := budgetRe.FindStringSubmatch(entry)
+		if matches == nil {
+			return nil, fmt.Errorf("invalid budget %q in $BP_RAILS_ASSETS_BUDGETS: must be written as \"[total ]<pattern> <= <size>[ gzip|raw]\"", entry)
+		}
+
+		budget, err := newAssetBudget(matches[2], matches[3], matches[1] != "", matches[4])
+		if err != nil {
+			return nil, fmt.Errorf("invalid budget %q in $BP_RAILS_ASSETS_BUDGETS: %w", entry, err)
+		}
+
+		budget.Source = "$BP_RAILS_ASSETS_BUDGETS"
+		budgets = append(budgets, budget)
+	}
+
+	return budgets, nil
+}
+
+func newAssetBudget(pattern, max string, total bool, compression string) (AssetBudget, error) {
+	if pattern == "" {
+		return AssetBudget{}, errors.New("pattern is required")
+	}
+
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return AssetBudget{}, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	maxBytes, err := parseSize(max)
+	if err != nil {
+		return AssetBudget{}, err
+	}
+
+	if compression != "" && compression != "gzip" && compression != "raw" {
+		return AssetBudget{}, fmt.Errorf("invalid compression %q: must be %q or %q", compression, "gzip", "raw")
+	}
+
+	return AssetBudget{
+		Pattern:    pattern,
+		MaxBytes:   maxBytes,
+		Total:      total,
+		Compressed: compression == "gzip",
+	}, nil
+}
+
+// parseSize parses a size such as 300KB, 1.5MiB or 2048. Like formatBytes,
+// it uses binary units, so KB and KiB both mean 1024 bytes.
+func parseSize(size string) (int64, error) {
+	matches := sizeRe.FindStringSubmatch(size)
+	if matches == nil {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+
+	value, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+
+	multiplier := map[string]float64{
+		"":    1,
+		"B":   1,
+		"KB":  1 << 10,
+		"MB":  1 << 20,
+		"GB":  1 << 30,
+		"KiB": 1 << 10,
+		"MiB": 1 << 20,
+		"GiB": 1 << 30,
+	}[matches[2]]
+
+	return int64(value * multiplier), nil
+}
+
+// CheckAssetBudgets compares the sizes of the compiled assets against the
+// budgets and returns every violation.
+func CheckAssetBudgets(budgets []AssetBudget, sizes []AssetSize) []BudgetViolation {
+	var violations []BudgetViolation
+
+	for _, budget := range budgets {
+		var (
+			total   int64
+			matched int
+		)
+
+		for _, size := range sizes {
+			if !budget.matches(size) {
+				continue
+			}
+
+			bytes := size.Bytes
+			if budget.Compressed {
+				bytes = size.CompressedBytes
+			}
+
+			if !budget.Total && bytes > budget.MaxBytes {
+				violations = append(violations, BudgetViolation{Budget: budget, Asset: size.LogicalPath, Bytes: bytes})
+			}
+
+			total += bytes
+			matched++
+		}
+
+		if budget.Total && total > budget.MaxBytes {
+			violations = append(violations, BudgetViolation{Budget: budget, Asset: fmt.Sprintf("%d assets", matched), Bytes: total})
+		}
+	}
+
+	return violations
+}
+
+func (b AssetBudget) matches(size AssetSize) bool {
+	if matched, _ := path.Match(b.Pattern, filepath.Base(size.File)); matched {
+		return true
+	}
+
+	matched, _ := path.Match(b.Pattern, size.LogicalPath)
+	return matched
+}
+
+// formatBudgetViolations lays out the violations as a table, one line per
+// violation after the header.
+func formatBudgetViolations(violations []BudgetViolation) []string {
+	rows := [][]string{{"BUDGET", "ASSET", "SIZE", "LIMIT", "OVER"}}
+	for _, violation := range violations {
+		over := violation.Bytes - violation.Budget.MaxBytes
+		rows = append(rows, []string{
+			violation.Budget.String(),
+			violation.Asset,
+			formatBytes(violation.Bytes),
+			formatBytes(violation.Budget.MaxBytes),
+			fmt.Sprintf("+%s (%.0f%%)", formatBytes(over), float64(over)*100/float64(max(violation.Budget.MaxBytes, 1))),
+		})
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+
+	var lines []string
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			if i == len(row)-1 {
+				line.WriteString(cell)
+				break
+			}
+			fmt.Fprintf(&line, "%-*s  ", widths[i], cell)
+		}
+		lines = append(lines, line.String())
+	}
+
+	return lines
+}
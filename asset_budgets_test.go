@@ -0,0 +1,179 @@
+package railsassets_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	railsassets "github.com/paketo-buildpacks/rails-assets"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testAssetBudgets(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("ParseAssetBudgets", func() {
+		it("returns no budgets when none are defined", func() {
+			budgets, err := railsassets.ParseAssetBudgets(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(budgets).To(BeEmpty())
+		})
+
+		context("when config/asset_budgets.yml exists", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(workingDir, "config"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "config", "asset_budgets.yml"), []byte(`
+budgets:
+  - pattern: application-*.js
+    max: 300KB
+    compression: gzip
+  - pattern: "*.css"
+    max: 150 KiB
+    total: true
+  - pattern: "*.png"
+    max: 2048
+`), 0600)).To(Succeed())
+			})
+
+			it("reads the budgets from the file", func() {
+				budgets, err := railsassets.ParseAssetBudgets(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(budgets).To(Equal([]railsassets.AssetBudget{
+					{Pattern: "application-*.js", MaxBytes: 300 * 1024, Compressed: true, Source: filepath.Join("config", "asset_budgets.yml")},
+					{Pattern: "*.css", MaxBytes: 153600, Total: true, Source: filepath.Join("config", "asset_budgets.yml")},
+					{Pattern: "*.png", MaxBytes: 2048, Source: filepath.Join("config", "asset_budgets.yml")},
+				}))
+			})
+
+			context("when BP_RAILS_ASSETS_BUDGETS is also set", func() {
+				it.Before(func() {
+					t.Setenv("BP_RAILS_ASSETS_BUDGETS", "vendor-*.js <= 1.5MB gzip; total *.svg <= 20KB raw")
+				})
+
+				it("adds the budgets from the variable", func() {
+					budgets, err := railsassets.ParseAssetBudgets(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(budgets).To(HaveLen(5))
+					Expect(budgets[3:]).To(Equal([]railsassets.AssetBudget{
+						{Pattern: "vendor-*.js", MaxBytes: 1.5 * 1024 * 1024, Compressed: true, Source: "$BP_RAILS_ASSETS_BUDGETS"},
+						{Pattern: "*.svg", MaxBytes: 20 * 1024, Total: true, Source: "$BP_RAILS_ASSETS_BUDGETS"},
+					}))
+				})
+			})
+
+			context("when a budget has an invalid size", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "config", "asset_budgets.yml"), []byte("budgets:\n  - pattern: '*.js'\n    max: large\n"), 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := railsassets.ParseAssetBudgets(workingDir)
+					Expect(err).To(MatchError(`invalid budget 1 in config/asset_budgets.yml: invalid size "large"`))
+				})
+			})
+
+			context("when a budget has an invalid compression", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "config", "asset_budgets.yml"), []byte("budgets:\n  - pattern: '*.js'\n    max: 1KB\n    compression: brotli\n"), 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := railsassets.ParseAssetBudgets(workingDir)
+					Expect(err).To(MatchError(`invalid budget 1 in config/asset_budgets.yml: invalid compression "brotli": must be "gzip" or "raw"`))
+				})
+			})
+
+			context("when the file does not parse", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "config", "asset_budgets.yml"), []byte("budgets: ["), 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := railsassets.ParseAssetBudgets(workingDir)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse config/asset_budgets.yml")))
+				})
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_BUDGETS is malformed", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_BUDGETS", "*.js 300KB")
+			})
+
+			it("returns an error", func() {
+				_, err := railsassets.ParseAssetBudgets(workingDir)
+				Expect(err).To(MatchError(`invalid budget "*.js 300KB" in $BP_RAILS_ASSETS_BUDGETS: must be written as "[total ]<pattern> <= <size>[ gzip|raw]"`))
+			})
+		})
+
+		context("when a pattern is malformed", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_BUDGETS", "[*.js <= 300KB")
+			})
+
+			it("returns an error", func() {
+				_, err := railsassets.ParseAssetBudgets(workingDir)
+				Expect(err).To(MatchError(ContainSubstring(`invalid pattern "[*.js"`)))
+			})
+		})
+	})
+
+	context("CheckAssetBudgets", func() {
+		var sizes []railsassets.AssetSize
+
+		it.Before(func() {
+			sizes = []railsassets.AssetSize{
+				{LogicalPath: "application.js", File: "public/assets/application-abc.js", Bytes: 400, CompressedBytes: 100},
+				{LogicalPath: "admin/application.css", File: "public/assets/admin/application-def.css", Bytes: 300, CompressedBytes: 80},
+				{LogicalPath: "application.css", File: "public/assets/application-123.css", Bytes: 200, CompressedBytes: 60},
+			}
+		})
+
+		it("reports each matching asset that is over budget", func() {
+			budget := railsassets.AssetBudget{Pattern: "application-*", MaxBytes: 250}
+
+			Expect(railsassets.CheckAssetBudgets([]railsassets.AssetBudget{budget}, sizes)).To(Equal([]railsassets.BudgetViolation{
+				{Budget: budget, Asset: "application.js", Bytes: 400},
+				{Budget: budget, Asset: "admin/application.css", Bytes: 300},
+			}))
+		})
+
+		it("matches patterns against the logical path", func() {
+			budget := railsassets.AssetBudget{Pattern: "admin/*.css", MaxBytes: 250}
+
+			Expect(railsassets.CheckAssetBudgets([]railsassets.AssetBudget{budget}, sizes)).To(Equal([]railsassets.BudgetViolation{
+				{Budget: budget, Asset: "admin/application.css", Bytes: 300},
+			}))
+		})
+
+		it("uses the compressed size for gzip budgets", func() {
+			budgets := []railsassets.AssetBudget{{Pattern: "*.js", MaxBytes: 150, Compressed: true}}
+
+			Expect(railsassets.CheckAssetBudgets(budgets, sizes)).To(BeEmpty())
+		})
+
+		it("totals the matching assets for total budgets", func() {
+			budget := railsassets.AssetBudget{Pattern: "*.css", MaxBytes: 400, Total: true}
+
+			Expect(railsassets.CheckAssetBudgets([]railsassets.AssetBudget{budget}, sizes)).To(Equal([]railsassets.BudgetViolation{
+				{Budget: budget, Asset: "2 assets", Bytes: 500},
+			}))
+		})
+	})
+}
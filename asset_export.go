@@ -0,0 +1,256 @@
+package railsassets
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// ExportIndexName is the name of the JSON index that describes the
+	// exported assets.
+	ExportIndexName = "index.json"
+
+	// ExportTarballName is the name of the tarball written by the "tarball"
+	// export format.
+	ExportTarballName = "assets.tar.gz"
+
+	// exportTreeName is the directory of the export that holds the assets,
+	// laid out as they are served from the public directory.
+	exportTreeName = "public"
+)
+
+// ExportFormat is the form in which the compiled assets are exported for
+// publishing to a CDN.
+type ExportFormat string
+
+const (
+	// ExportDirectory writes the assets into a directory tree next to the
+	// JSON index.
+	ExportDirectory ExportFormat = "directory"
+
+	// ExportTarball writes the directory tree and the JSON index into a
+	// gzipped tarball.
+	ExportTarball ExportFormat = "tarball"
+)
+
+// ParseExportFormat reads $BP_RAILS_ASSETS_EXPORT, which is "directory",
+// "tarball" or a boolean, where "true" means "directory". No format is
+// returned when exporting is disabled, which is the default.
+func ParseExportFormat() (ExportFormat, error) {
+	switch format := ExportFormat(os.Getenv("BP_RAILS_ASSETS_EXPORT")); format {
+	case "", "false":
+		return "", nil
+	case "true":
+		return ExportDirectory, nil
+	case ExportDirectory, ExportTarball:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid BP_RAILS_ASSETS_EXPORT %q: must be a boolean, %q or %q", format, ExportDirectory, ExportTarball)
+	}
+}
+
+// ExportedAsset describes a file in the JSON index of an export.
+type ExportedAsset struct {
+	// Path is the URL path of the file, relative to the asset host, such as
+	// assets/application-abc.js.
+	Path string `json:"path"`
+
+	// Digest is the hex encoded SHA-256 of the file.
+	Digest string `json:"digest"`
+
+	// ContentType is the MIME type that the file is served with. For gzip and
+	// brotli variants, it is the type of the original file.
+	ContentType string `json:"content_type"`
+
+	// ContentEncoding is "gzip" or "br" for precompressed variants.
+	ContentEncoding string `json:"content_encoding,omitempty"`
+
+	// Size is the size of the file in bytes.
+	Size int64 `json:"size"`
+
+	// Integrity is the subresource integrity hash of the file.
+	Integrity string `json:"integrity"`
+}
+
+// ExportIndex is the JSON index written next to the exported assets.
+type ExportIndex struct {
+	Assets []ExportedAsset `json:"assets"`
+}
+
+// ExportAssets copies the compiled output of the asset pipelines into the
+// destination, along with an index that lists the path, digest, content type,
+// size and integrity hash of each file. Paths are relative to the public
+// directory of the application, which is where the asset host serves them
+// from. With the "directory" format, the files are written under
+// destination/public and the index to destination/index.json. With the
+// "tarball" format, both are written into destination/assets.tar.gz.
+func ExportAssets(workingDir, destination string, format ExportFormat) (ExportIndex, error) {
+	files, err := compiledFiles(workingDir)
+	if err != nil {
+		return ExportIndex{}, err
+	}
+
+	index := ExportIndex{Assets: []ExportedAsset{}}
+	for _, path := range files {
+		asset, err := describeAsset(workingDir, path)
+		if err != nil {
+			return ExportIndex{}, err
+		}
+		index.Assets = append(index.Assets, asset)
+	}
+
+	content, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return ExportIndex{}, err
+	}
+
+	err = os.MkdirAll(destination, os.ModePerm)
+	if err != nil {
+		return ExportIndex{}, err
+	}
+
+	if format == ExportTarball {
+		err = writeExportTarball(filepath.Join(destination, ExportTarballName), files, index, content)
+		if err != nil {
+			return ExportIndex{}, err
+		}
+
+		return index, nil
+	}
+
+	for i, path := range files {
+		err = copyFile(path, filepath.Join(destination, exportTreeName, filepath.FromSlash(index.Assets[i].Path)))
+		if err != nil {
+			return ExportIndex{}, err
+		}
+	}
+
+	err = os.WriteFile(filepath.Join(destination, ExportIndexName), content, 0644)
+	if err != nil {
+		return ExportIndex{}, err
+	}
+
+	return index, nil
+}
+
+// describeAsset computes the index entry of a compiled file.
+func describeAsset(workingDir, path string) (ExportedAsset, error) {
+	rel, err := filepath.Rel(filepath.Join(workingDir, "public"), path)
+	if err != nil {
+		return ExportedAsset{}, err
+	}
+
+	// Output directories outside of the public directory are not served by
+	// Rails, but are exported relative to the working directory all the same.
+	if strings.HasPrefix(rel, "..") {
+		rel, err = filepath.Rel(workingDir, path)
+		if err != nil {
+			return ExportedAsset{}, err
+		}
+	}
+
+	asset := ExportedAsset{
+		Path:        filepath.ToSlash(rel),
+		ContentType: contentType(path),
+	}
+
+	switch filepath.Ext(path) {
+	case PrecompressGzip.Extension():
+		asset.ContentType = contentType(strings.TrimSuffix(path, PrecompressGzip.Extension()))
+		asset.ContentEncoding = "gzip"
+	case PrecompressBrotli.Extension():
+		asset.ContentType = contentType(strings.TrimSuffix(path, PrecompressBrotli.Extension()))
+		asset.ContentEncoding = "br"
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return ExportedAsset{}, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	asset.Size, err = io.Copy(hash, file)
+	if err != nil {
+		return ExportedAsset{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	asset.Digest = hex.EncodeToString(hash.Sum(nil))
+
+	asset.Integrity, err = integrityHash(path, "")
+	if err != nil {
+		return ExportedAsset{}, err
+	}
+
+	return asset, nil
+}
+
+// writeExportTarball writes the index and the files, under the public
+// directory, into a gzipped tarball. The entries carry a fixed modification
+// time so that unchanged assets produce the same tarball.
+func writeExportTarball(path string, files []string, index ExportIndex, content []byte) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	modTime := time.Unix(0, 0)
+	err = tarWriter.WriteHeader(&tar.Header{Name: ExportIndexName, Mode: 0644, Size: int64(len(content)), ModTime: modTime})
+	if err != nil {
+		return err
+	}
+
+	_, err = tarWriter.Write(content)
+	if err != nil {
+		return err
+	}
+
+	for i, source := range files {
+		asset := index.Assets[i]
+		err = tarWriter.WriteHeader(&tar.Header{Name: exportTreeName + "/" + asset.Path, Mode: 0644, Size: asset.Size, ModTime: modTime})
+		if err != nil {
+			return err
+		}
+
+		err = copyInto(tarWriter, source)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	err = gzipWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// copyInto copies the contents of a file into the writer.
+func copyInto(writer io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(writer, file)
+	return err
+}
@@ -0,0 +1,173 @@
+package railsassets_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	railsassets "github.com/paketo-buildpacks/rails-assets"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testAssetExport(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir  string
+		destination string
+		assetsDir   string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		destination, err = os.MkdirTemp("", "destination")
+		Expect(err).NotTo(HaveOccurred())
+
+		assetsDir = filepath.Join(workingDir, "public", "assets")
+		Expect(os.MkdirAll(filepath.Join(assetsDir, "icons"), os.ModePerm)).To(Succeed())
+
+		Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    propshaft (1.2.0)\n"), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(assetsDir, ".manifest.json"), []byte(`{"application.js": "application-abc.js", "icons/logo.svg": "icons/logo-def.svg"}`), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(assetsDir, "application-abc.js"), []byte("console.log(1);\n"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(assetsDir, "application-abc.js.gz"), []byte("compressed"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(assetsDir, "icons", "logo-def.svg"), []byte("<svg/>"), 0644)).To(Succeed())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+		Expect(os.RemoveAll(destination)).To(Succeed())
+	})
+
+	context("ParseExportFormat", func() {
+		it("is disabled by default", func() {
+			format, err := railsassets.ParseExportFormat()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(format).To(BeEmpty())
+		})
+
+		context("when BP_RAILS_ASSETS_EXPORT=true", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_EXPORT", "true")
+			})
+
+			it("returns the directory format", func() {
+				format, err := railsassets.ParseExportFormat()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(format).To(Equal(railsassets.ExportDirectory))
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_EXPORT=tarball", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_EXPORT", "tarball")
+			})
+
+			it("returns the tarball format", func() {
+				format, err := railsassets.ParseExportFormat()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(format).To(Equal(railsassets.ExportTarball))
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_EXPORT is invalid", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_EXPORT", "zip")
+			})
+
+			it("returns an error", func() {
+				_, err := railsassets.ParseExportFormat()
+				Expect(err).To(MatchError(`invalid BP_RAILS_ASSETS_EXPORT "zip": must be a boolean, "directory" or "tarball"`))
+			})
+		})
+	})
+
+	context("ExportAssets", func() {
+		it("indexes the compiled files", func() {
+			index, err := railsassets.ExportAssets(workingDir, destination, railsassets.ExportDirectory)
+			Expect(err).NotTo(HaveOccurred())
+
+			content := []byte("console.log(1);\n")
+			digest := sha256.Sum256(content)
+			integrity := sha512.Sum384(content)
+
+			Expect(index.Assets).To(HaveLen(3))
+			Expect(index.Assets[0]).To(Equal(railsassets.ExportedAsset{
+				Path:        "assets/application-abc.js",
+				Digest:      hex.EncodeToString(digest[:]),
+				ContentType: "text/javascript",
+				Size:        int64(len(content)),
+				Integrity:   "sha384-" + base64.StdEncoding.EncodeToString(integrity[:]),
+			}))
+			Expect(index.Assets[1].Path).To(Equal("assets/application-abc.js.gz"))
+			Expect(index.Assets[1].ContentType).To(Equal("text/javascript"))
+			Expect(index.Assets[1].ContentEncoding).To(Equal("gzip"))
+			Expect(index.Assets[2].Path).To(Equal("assets/icons/logo-def.svg"))
+			Expect(index.Assets[2].ContentType).To(Equal("image/svg+xml"))
+		})
+
+		it("writes a directory tree and the index", func() {
+			index, err := railsassets.ExportAssets(workingDir, destination, railsassets.ExportDirectory)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.ReadFile(filepath.Join(destination, "public", "assets", "application-abc.js"))).To(Equal([]byte("console.log(1);\n")))
+			Expect(os.ReadFile(filepath.Join(destination, "public", "assets", "icons", "logo-def.svg"))).To(Equal([]byte("<svg/>")))
+			Expect(filepath.Join(destination, "public", "assets", ".manifest.json")).NotTo(BeAnExistingFile())
+
+			content, err := os.ReadFile(filepath.Join(destination, "index.json"))
+			Expect(err).NotTo(HaveOccurred())
+
+			var written railsassets.ExportIndex
+			Expect(json.Unmarshal(content, &written)).To(Succeed())
+			Expect(written).To(Equal(index))
+		})
+
+		context("with the tarball format", func() {
+			it("writes the tree and the index into a tarball", func() {
+				_, err := railsassets.ExportAssets(workingDir, destination, railsassets.ExportTarball)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filepath.Join(destination, "index.json")).NotTo(BeAnExistingFile())
+
+				file, err := os.Open(filepath.Join(destination, "assets.tar.gz"))
+				Expect(err).NotTo(HaveOccurred())
+				defer file.Close()
+
+				gzipReader, err := gzip.NewReader(file)
+				Expect(err).NotTo(HaveOccurred())
+
+				entries := map[string]string{}
+				tarReader := tar.NewReader(gzipReader)
+				for {
+					header, err := tarReader.Next()
+					if err == io.EOF {
+						break
+					}
+					Expect(err).NotTo(HaveOccurred())
+
+					content, err := io.ReadAll(tarReader)
+					Expect(err).NotTo(HaveOccurred())
+					entries[header.Name] = string(content)
+				}
+
+				Expect(entries).To(HaveLen(4))
+				Expect(entries).To(HaveKey("index.json"))
+				Expect(entries).To(HaveKeyWithValue("public/assets/application-abc.js", "console.log(1);\n"))
+				Expect(entries).To(HaveKeyWithValue("public/assets/application-abc.js.gz", "compressed"))
+				Expect(entries).To(HaveKeyWithValue("public/assets/icons/logo-def.svg", "<svg/>"))
+			})
+		})
+	})
+}
@@ -0,0 +1,376 @@
+package railsassets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AssetManifest is a manifest written by an asset pipeline that maps logical
+// asset paths to the compiled files.
+type AssetManifest struct {
+	// Pipeline is one of "sprockets", "propshaft", "webpacker",
+	// "shakapacker" or "vite".
+	Pipeline string
+
+	// Path is the path of the manifest, relative to the working directory.
+	Path string
+
+	// Entries are the compiled files listed in the manifest.
+	Entries []ManifestEntry
+}
+
+// ManifestEntry is a compiled file listed in an asset manifest.
+type ManifestEntry struct {
+	// LogicalPath is the path that the application uses to refer to the
+	// asset, such as application.js.
+	LogicalPath string
+
+	// File is the path of the compiled file, relative to the working
+	// directory.
+	File string
+}
+
+// manifestLocation is where an asset pipeline writes its manifest, and the
+// directory that the paths in the manifest are relative to.
+type manifestLocation struct {
+	pipeline string
+	path     string
+	root     string
+	output   string
+}
+
+// VerifyAssets checks the output of the asset pipelines that the application
+// uses. Each manifest that is expected must exist and parse, every file that
+// it lists must exist, and the directory it is written to must contain
+// compiled assets besides the manifest. It returns a description of each
+// problem that it finds.
+//
+// When compiledAt is not zero, the output is that of a precompile started at
+// that time: every manifest must have been written since, and for
+// jsbundling-rails and cssbundling-rails applications app/assets/builds must
+// contain generated output. Neither is checked for a reused "assets" layer,
+// whose manifests are older and which does not hold app/assets/builds.
+func VerifyAssets(workingDir string, compiledAt time.Time) ([]string, error) {
+	lock, err := NewGemfileLockParser().Parse(filepath.Join(workingDir, "Gemfile.lock"))
+	if err != nil {
+		return nil, err
+	}
+
+	locations, problems, err := findAssetManifests(workingDir, lock)
+	if err != nil {
+		return nil, err
+	}
+
+	if !compiledAt.IsZero() && usesBundling(lock) {
+		empty, err := isEmptyDirectory(filepath.Join(workingDir, "app", "assets", "builds"), "")
+		if err != nil {
+			return nil, err
+		}
+
+		if empty {
+			problems = append(problems, "app/assets/builds contains no output from jsbundling-rails or cssbundling-rails")
+		}
+	}
+
+	for _, location := range locations {
+		if !compiledAt.IsZero() {
+			info, err := os.Stat(filepath.Join(workingDir, location.path))
+			if err != nil {
+				return nil, err
+			}
+
+			// File systems with a coarse modification time may record a
+			// manifest written right after the start in the same second.
+			if info.ModTime().Before(compiledAt.Truncate(time.Second)) {
+				problems = append(problems, fmt.Sprintf("%s was not written by this precompile", location.path))
+			}
+		}
+
+		empty, err := isEmptyOutput(workingDir, location)
+		if err != nil {
+			return nil, err
+		}
+
+		if empty {
+			problems = append(problems, fmt.Sprintf("%s contains no compiled assets", location.output))
+		}
+
+		manifest, err := parseAssetManifest(workingDir, location)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+
+		for _, entry := range manifest.Entries {
+			_, err := os.Stat(filepath.Join(workingDir, entry.File))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s lists %s (%s), which does not exist", manifest.Path, entry.File, entry.LogicalPath))
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// findAssetManifests returns the manifests that exist in the working
+// directory, along with a description of each manifest that the pipelines in
+// the Gemfile.lock should have written but did not.
+func findAssetManifests(workingDir string, lock GemfileLock) ([]manifestLocation, []string, error) {
+	var (
+		locations []manifestLocation
+		problems  []string
+	)
+
+	webpacker, usesWebpacker, err := ParseWebpackerConfig(workingDir, lock)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if usesWebpacker {
+		location := manifestLocation{pipeline: webpacker.Gem, path: webpacker.ManifestPath(), root: webpacker.PublicRootPath, output: webpacker.PublicOutputPath}
+		if exists(filepath.Join(workingDir, location.path)) {
+			locations = append(locations, location)
+		} else {
+			problems = append(problems, fmt.Sprintf("%s manifest %s does not exist; check public_output_path in %s", webpacker.Gem, location.path, webpacker.ConfigPath))
+		}
+	}
+
+	vite, usesVite, err := ParseViteConfig(workingDir, lock)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if usesVite {
+		location := manifestLocation{pipeline: "vite", path: filepath.Join(vite.PublicOutputDir, ".vite", "manifest.json"), root: vite.PublicOutputDir, output: vite.PublicOutputDir}
+		if !exists(filepath.Join(workingDir, location.path)) {
+			location.path = filepath.Join(vite.PublicOutputDir, "manifest.json")
+		}
+
+		if exists(filepath.Join(workingDir, location.path)) {
+			locations = append(locations, location)
+		} else {
+			problems = append(problems, fmt.Sprintf("vite manifest %s does not exist", filepath.Join(vite.PublicOutputDir, ".vite", "manifest.json")))
+		}
+	}
+
+	prefix, err := discoverAssetsPrefix(workingDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if prefix.Path == "" {
+		prefix.Path = filepath.Join("public", "assets")
+	}
+
+	sprockets, err := newestFile(workingDir, filepath.Join(prefix.Path, ".sprockets-manifest-*.json"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if sprockets != "" {
+		locations = append(locations, manifestLocation{pipeline: "sprockets", path: sprockets, root: prefix.Path, output: prefix.Path})
+	}
+
+	propshaft := filepath.Join(prefix.Path, ".manifest.json")
+	if exists(filepath.Join(workingDir, propshaft)) {
+		locations = append(locations, manifestLocation{pipeline: "propshaft", path: propshaft, root: prefix.Path, output: prefix.Path})
+	}
+
+	// Sprockets and Propshaft always write a manifest, but are also pulled in
+	// by Rails itself, so they are only expected to have run when nothing
+	// else compiles the assets.
+	usesAssetPipeline := lock.Has("sprockets-rails") || lock.Has("propshaft")
+	if usesAssetPipeline && !usesWebpacker && !usesVite && sprockets == "" && !exists(filepath.Join(workingDir, propshaft)) {
+		problems = append(problems, fmt.Sprintf("no Sprockets or Propshaft manifest exists in %s", prefix.Path))
+	}
+
+	return locations, problems, nil
+}
+
+// parseAssetManifest reads the entries of a manifest in the format of its
+// pipeline.
+func parseAssetManifest(workingDir string, location manifestLocation) (AssetManifest, error) {
+	content, err := os.ReadFile(filepath.Join(workingDir, location.path))
+	if err != nil {
+		return AssetManifest{}, fmt.Errorf("failed to read %s: %w", location.path, err)
+	}
+
+	manifest := AssetManifest{Pipeline: location.pipeline, Path: location.path}
+	entries := map[string]string{}
+
+	switch location.pipeline {
+	case "sprockets":
+		var sprockets struct {
+			Files map[string]struct {
+				LogicalPath string `json:"logical_path"`
+			} `json:"files"`
+		}
+
+		err = json.Unmarshal(content, &sprockets)
+		for file, info := range sprockets.Files {
+			entries[file] = info.LogicalPath
+		}
+
+	case "propshaft":
+		var propshaft map[string]json.RawMessage
+		err = json.Unmarshal(content, &propshaft)
+		for logicalPath, raw := range propshaft {
+			var file string
+			if json.Unmarshal(raw, &file) != nil {
+				var entry struct {
+					DigestedPath string `json:"digested_path"`
+				}
+				if json.Unmarshal(raw, &entry) != nil || entry.DigestedPath == "" {
+					continue
+				}
+				file = entry.DigestedPath
+			}
+			entries[file] = logicalPath
+		}
+
+	case "vite":
+		var vite map[string]struct {
+			File   string   `json:"file"`
+			CSS    []string `json:"css"`
+			Assets []string `json:"assets"`
+		}
+
+		err = json.Unmarshal(content, &vite)
+		for logicalPath, chunk := range vite {
+			if chunk.File != "" {
+				entries[chunk.File] = logicalPath
+			}
+			for _, file := range append(chunk.CSS, chunk.Assets...) {
+				if _, ok := entries[file]; !ok {
+					entries[file] = file
+				}
+			}
+		}
+
+	default:
+		var webpacker map[string]json.RawMessage
+		err = json.Unmarshal(content, &webpacker)
+		for logicalPath, raw := range webpacker {
+			var value string
+			if json.Unmarshal(raw, &value) != nil {
+				continue
+			}
+
+			// The paths are URLs, which include the asset host when one is
+			// configured.
+			if parsed, err := url.Parse(value); err == nil && parsed.Host != "" {
+				value = parsed.Path
+			}
+
+			entries[strings.TrimPrefix(value, "/")] = logicalPath
+		}
+	}
+
+	if err != nil {
+		return AssetManifest{}, fmt.Errorf("failed to parse %s: %w", location.path, err)
+	}
+
+	for file, logicalPath := range entries {
+		manifest.Entries = append(manifest.Entries, ManifestEntry{
+			LogicalPath: logicalPath,
+			File:        filepath.Join(location.root, filepath.FromSlash(file)),
+		})
+	}
+
+	sort.Slice(manifest.Entries, func(i, j int) bool {
+		return manifest.Entries[i].LogicalPath < manifest.Entries[j].LogicalPath ||
+			(manifest.Entries[i].LogicalPath == manifest.Entries[j].LogicalPath && manifest.Entries[i].File < manifest.Entries[j].File)
+	})
+
+	return manifest, nil
+}
+
+// isEmptyOutput reports whether the output directory of a pipeline contains
+// nothing but its manifest. The directory is usually a link into the
+// "assets" layer, which is followed.
+func isEmptyOutput(workingDir string, location manifestLocation) (bool, error) {
+	output, err := filepath.EvalSymlinks(filepath.Join(workingDir, location.output))
+	if err != nil {
+		return false, err
+	}
+
+	manifest, err := filepath.EvalSymlinks(filepath.Join(workingDir, location.path))
+	if err != nil {
+		return false, err
+	}
+
+	return isEmptyDirectory(output, manifest)
+}
+
+// isEmptyDirectory reports whether a directory contains nothing but the given
+// file and any .keep or .gitkeep file. A directory that does not exist is
+// empty.
+func isEmptyDirectory(dir, except string) (bool, error) {
+	empty := true
+	err := filepath.WalkDir(dir, func(path string, entry iofs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if entry.IsDir() || path == except || entry.Name() == ".keep" || entry.Name() == ".gitkeep" {
+			return nil
+		}
+
+		empty = false
+		return filepath.SkipAll
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return empty, nil
+}
+
+// newestFile returns the most recently modified file, relative to the working
+// directory, that matches any of the patterns.
+func newestFile(workingDir string, patterns ...string) (string, error) {
+	var (
+		newest   string
+		newestAt int64
+	)
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(workingDir, pattern))
+		if err != nil {
+			return "", err
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return "", err
+			}
+
+			if newest == "" || info.ModTime().UnixNano() > newestAt {
+				newest, err = filepath.Rel(workingDir, match)
+				if err != nil {
+					return "", err
+				}
+				newestAt = info.ModTime().UnixNano()
+			}
+		}
+	}
+
+	return newest, nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, os.ErrNotExist)
+}
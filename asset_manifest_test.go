@@ -0,0 +1,272 @@
+package railsassets_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	railsassets "github.com/paketo-buildpacks/rails-assets"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testAssetManifest(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+		compiledAt time.Time
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		compiledAt = time.Now()
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	writeFile := func(path, content string) {
+		Expect(os.MkdirAll(filepath.Join(workingDir, filepath.Dir(path)), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(workingDir, path), []byte(content), 0600)).To(Succeed())
+	}
+
+	context("VerifyAssets", func() {
+		context("when the app uses sprockets", func() {
+			it.Before(func() {
+				writeFile("Gemfile.lock", "GEM\n  specs:\n    sprockets-rails (3.4.2)\n")
+				writeFile("public/assets/.sprockets-manifest-0123.json", `{
+					"files": {
+						"application-abc.js": {"logical_path": "application.js", "size": 10},
+						"logo-def.png": {"logical_path": "logo.png", "size": 20}
+					},
+					"assets": {"application.js": "application-abc.js", "logo.png": "logo-def.png"}
+				}`)
+				writeFile("public/assets/application-abc.js", "")
+			})
+
+			it("reports the files that are missing", func() {
+				problems, err := railsassets.VerifyAssets(workingDir, compiledAt)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(problems).To(Equal([]string{
+					"public/assets/.sprockets-manifest-0123.json lists public/assets/logo-def.png (logo.png), which does not exist",
+				}))
+			})
+		})
+
+		context("when the app uses propshaft", func() {
+			it.Before(func() {
+				writeFile("Gemfile.lock", "GEM\n  specs:\n    propshaft (1.1.0)\n")
+				writeFile("config/application.rb", `config.assets.prefix = "/static"`)
+				writeFile("public/static/.manifest.json", `{
+					"application.css": {"digested_path": "application-abc.css", "integrity": "sha384-abc"},
+					"logo.png": "logo-def.png"
+				}`)
+				writeFile("public/static/application-abc.css", "")
+				writeFile("public/static/logo-def.png", "")
+			})
+
+			it("reads both manifest formats from the assets prefix", func() {
+				problems, err := railsassets.VerifyAssets(workingDir, compiledAt)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(problems).To(BeEmpty())
+			})
+		})
+
+		context("when the app uses shakapacker", func() {
+			it.Before(func() {
+				writeFile("Gemfile.lock", "GEM\n  specs:\n    shakapacker (7.2.0)\n    sprockets-rails (3.4.2)\n")
+				writeFile("public/packs/manifest.json", `{
+					"application.js": "/packs/js/application-abc.js",
+					"logo.png": "https://cdn.example.com/packs/static/logo-def.png",
+					"entrypoints": {"application": {"assets": {"js": ["/packs/js/application-abc.js"]}}}
+				}`)
+				writeFile("public/packs/js/application-abc.js", "")
+			})
+
+			it("resolves the paths against the public root", func() {
+				problems, err := railsassets.VerifyAssets(workingDir, compiledAt)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(problems).To(Equal([]string{
+					"public/packs/manifest.json lists public/packs/static/logo-def.png (logo.png), which does not exist",
+				}))
+			})
+		})
+
+		context("when the shakapacker manifest is missing", func() {
+			it.Before(func() {
+				writeFile("Gemfile.lock", "GEM\n  specs:\n    shakapacker (7.2.0)\n")
+			})
+
+			it("reports it with a hint about the configuration", func() {
+				problems, err := railsassets.VerifyAssets(workingDir, compiledAt)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(problems).To(Equal([]string{
+					"shakapacker manifest public/packs/manifest.json does not exist; check public_output_path in config/webpacker.yml",
+				}))
+			})
+		})
+
+		context("when the app uses vite ruby", func() {
+			it.Before(func() {
+				writeFile("Gemfile.lock", "GEM\n  specs:\n    vite_rails (3.0.17)\n    vite_ruby (3.5.0)\n")
+				writeFile("public/vite/.vite/manifest.json", `{
+					"entrypoints/application.js": {"file": "assets/application-abc.js", "css": ["assets/application-def.css"], "isEntry": true}
+				}`)
+				writeFile("public/vite/assets/application-abc.js", "")
+				writeFile("public/vite/assets/application-def.css", "")
+			})
+
+			it("resolves the paths against the output directory", func() {
+				problems, err := railsassets.VerifyAssets(workingDir, compiledAt)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(problems).To(BeEmpty())
+			})
+		})
+
+		context("when an expected manifest is missing", func() {
+			it.Before(func() {
+				writeFile("Gemfile.lock", "GEM\n  specs:\n    propshaft (1.1.0)\n    vite_rails (3.0.17)\n")
+			})
+
+			it("reports it", func() {
+				problems, err := railsassets.VerifyAssets(workingDir, compiledAt)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(problems).To(Equal([]string{
+					"vite manifest public/vite/.vite/manifest.json does not exist",
+				}))
+			})
+		})
+
+		context("when only the asset pipeline is used and it wrote no manifest", func() {
+			it.Before(func() {
+				writeFile("Gemfile.lock", "GEM\n  specs:\n    sprockets-rails (3.4.2)\n")
+			})
+
+			it("reports it", func() {
+				problems, err := railsassets.VerifyAssets(workingDir, compiledAt)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(problems).To(Equal([]string{
+					"no Sprockets or Propshaft manifest exists in public/assets",
+				}))
+			})
+		})
+
+		context("when the output directory holds nothing but the manifest", func() {
+			it.Before(func() {
+				writeFile("Gemfile.lock", "GEM\n  specs:\n    sprockets-rails (3.4.2)\n")
+				writeFile("public/assets/.sprockets-manifest-0123.json", `{"files": {}, "assets": {}}`)
+				writeFile("public/assets/.keep", "")
+			})
+
+			it("reports it", func() {
+				problems, err := railsassets.VerifyAssets(workingDir, compiledAt)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(problems).To(Equal([]string{
+					"public/assets contains no compiled assets",
+				}))
+			})
+		})
+
+		context("when the output directory is a link into the layer", func() {
+			var layerDir string
+
+			it.Before(func() {
+				var err error
+				layerDir, err = os.MkdirTemp("", "layer")
+				Expect(err).NotTo(HaveOccurred())
+
+				writeFile("Gemfile.lock", "GEM\n  specs:\n    propshaft (1.1.0)\n")
+				Expect(os.WriteFile(filepath.Join(layerDir, ".manifest.json"), []byte(`{"application.css": "application-abc.css"}`), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(layerDir, "application-abc.css"), nil, 0600)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(workingDir, "public"), os.ModePerm)).To(Succeed())
+				Expect(os.Symlink(layerDir, filepath.Join(workingDir, "public", "assets"))).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.RemoveAll(layerDir)).To(Succeed())
+			})
+
+			it("follows the link", func() {
+				problems, err := railsassets.VerifyAssets(workingDir, compiledAt)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(problems).To(BeEmpty())
+			})
+		})
+
+		context("when the app uses jsbundling-rails", func() {
+			it.Before(func() {
+				writeFile("Gemfile.lock", "GEM\n  specs:\n    jsbundling-rails (1.3.0)\n    propshaft (1.1.0)\n")
+				writeFile("public/assets/.manifest.json", `{"application.js": "application-abc.js"}`)
+				writeFile("public/assets/application-abc.js", "")
+				writeFile("app/assets/builds/.keep", "")
+			})
+
+			it("reports an app/assets/builds without generated output", func() {
+				problems, err := railsassets.VerifyAssets(workingDir, compiledAt)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(problems).To(Equal([]string{
+					"app/assets/builds contains no output from jsbundling-rails or cssbundling-rails",
+				}))
+			})
+
+			context("when app/assets/builds contains generated output", func() {
+				it.Before(func() {
+					writeFile("app/assets/builds/application.js", "")
+				})
+
+				it("reports nothing", func() {
+					problems, err := railsassets.VerifyAssets(workingDir, compiledAt)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(problems).To(BeEmpty())
+				})
+			})
+		})
+
+		context("when a manifest was written before the precompile", func() {
+			it.Before(func() {
+				writeFile("Gemfile.lock", "GEM\n  specs:\n    propshaft (1.1.0)\n")
+				writeFile("public/assets/.manifest.json", `{"application.js": "application-abc.js"}`)
+				writeFile("public/assets/application-abc.js", "")
+
+				earlier := compiledAt.Add(-time.Hour)
+				Expect(os.Chtimes(filepath.Join(workingDir, "public", "assets", ".manifest.json"), earlier, earlier)).To(Succeed())
+			})
+
+			it("reports it", func() {
+				problems, err := railsassets.VerifyAssets(workingDir, compiledAt)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(problems).To(Equal([]string{
+					"public/assets/.manifest.json was not written by this precompile",
+				}))
+			})
+
+			context("when the assets come from a reused layer", func() {
+				it("accepts it", func() {
+					problems, err := railsassets.VerifyAssets(workingDir, time.Time{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(problems).To(BeEmpty())
+				})
+			})
+		})
+
+		context("when a manifest does not parse", func() {
+			it.Before(func() {
+				writeFile("Gemfile.lock", "GEM\n  specs:\n    propshaft (1.1.0)\n")
+				writeFile("public/assets/.manifest.json", `{`)
+			})
+
+			it("reports it", func() {
+				problems, err := railsassets.VerifyAssets(workingDir, compiledAt)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(problems).To(ContainElement(ContainSubstring("failed to parse public/assets/.manifest.json")))
+			})
+		})
+	})
+}
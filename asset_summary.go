@@ -0,0 +1,204 @@
+package railsassets
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// AssetSummary describes the compiled assets listed in the manifests of the
+// asset pipelines.
+type AssetSummary struct {
+	Count           int
+	Bytes           int64
+	CompressedBytes int64
+
+	// Largest holds up to ten of the largest assets, largest first.
+	Largest []AssetSize
+
+	// ImageBytesSaved is the number of bytes that optimizing the images
+	// saved.
+	ImageBytesSaved int64
+}
+
+// AssetSize is the size of a compiled asset, identified by its logical path.
+type AssetSize struct {
+	LogicalPath string
+
+	// File is the path of the compiled file, relative to the working
+	// directory.
+	File string
+
+	Bytes           int64
+	CompressedBytes int64
+}
+
+// MeasureAssets measures the files listed in the manifests of the asset
+// pipelines that the application uses. The compressed size of a file is the
+// size of its .gz sibling, when the pipeline wrote one, or otherwise the size
+// it has after gzip compression. Manifests that cannot be parsed and files that
+// do not exist are left out; VerifyAssets reports them.
+func MeasureAssets(workingDir string) ([]AssetSize, error) {
+	lock, err := NewGemfileLockParser().Parse(filepath.Join(workingDir, "Gemfile.lock"))
+	if err != nil {
+		return nil, err
+	}
+
+	locations, _, err := findAssetManifests(workingDir, lock)
+	if err != nil {
+		return nil, err
+	}
+
+	var sizes []AssetSize
+	seen := map[string]bool{}
+	for _, location := range locations {
+		manifest, err := parseAssetManifest(workingDir, location)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range manifest.Entries {
+			if seen[entry.File] {
+				continue
+			}
+			seen[entry.File] = true
+
+			info, err := os.Stat(filepath.Join(workingDir, entry.File))
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				return nil, err
+			}
+
+			if !info.Mode().IsRegular() {
+				continue
+			}
+
+			compressed, err := compressedSize(filepath.Join(workingDir, entry.File))
+			if err != nil {
+				return nil, err
+			}
+
+			sizes = append(sizes, AssetSize{
+				LogicalPath:     entry.LogicalPath,
+				File:            entry.File,
+				Bytes:           info.Size(),
+				CompressedBytes: compressed,
+			})
+		}
+	}
+
+	return sizes, nil
+}
+
+// SummarizeAssets totals the sizes of the compiled assets and picks out the
+// largest ones.
+func SummarizeAssets(sizes []AssetSize) AssetSummary {
+	summary := AssetSummary{Count: len(sizes)}
+	for _, size := range sizes {
+		summary.Bytes += size.Bytes
+		summary.CompressedBytes += size.CompressedBytes
+	}
+
+	largest := append([]AssetSize(nil), sizes...)
+	sort.SliceStable(largest, func(i, j int) bool {
+		return largest[i].Bytes > largest[j].Bytes
+	})
+
+	if len(largest) > 10 {
+		largest = largest[:10]
+	}
+	summary.Largest = largest
+
+	return summary
+}
+
+// Metadata returns a compact form of the summary to store in the "assets"
+// layer metadata.
+func (s AssetSummary) Metadata() map[string]interface{} {
+	largest := []map[string]interface{}{}
+	for _, size := range s.Largest {
+		largest = append(largest, map[string]interface{}{
+			"logical_path":     size.LogicalPath,
+			"bytes":            size.Bytes,
+			"compressed_bytes": size.CompressedBytes,
+		})
+	}
+
+	metadata := map[string]interface{}{
+		"count":            s.Count,
+		"bytes":            s.Bytes,
+		"compressed_bytes": s.CompressedBytes,
+		"largest":          largest,
+	}
+
+	if s.ImageBytesSaved > 0 {
+		metadata["image_bytes_saved"] = s.ImageBytesSaved
+	}
+
+	return metadata
+}
+
+// compressedSize returns the size of the .gz sibling of a file, or the size of
+// the file after gzip compression when there is none.
+func compressedSize(path string) (int64, error) {
+	info, err := os.Stat(path + ".gz")
+	if err == nil {
+		return info.Size(), nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	counter := &countingWriter{}
+	writer := gzip.NewWriter(counter)
+
+	_, err = io.Copy(writer, file)
+	if err != nil {
+		return 0, fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return 0, fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+
+	return counter.n, nil
+}
+
+// formatBytes formats a size in bytes with a binary unit, such as 1.5 MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
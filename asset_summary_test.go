@@ -0,0 +1,142 @@
+package railsassets_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	railsassets "github.com/paketo-buildpacks/rails-assets"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testAssetSummary(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(workingDir, "public", "assets"), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    propshaft (1.1.0)\n"), 0600)).To(Succeed())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("MeasureAssets and SummarizeAssets", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets", ".manifest.json"), []byte(`{
+				"application.js": "application-abc.js",
+				"application.css": "application-def.css",
+				"missing.png": "missing-123.png"
+			}`), 0600)).To(Succeed())
+
+			Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets", "application-abc.js"), []byte(strings.Repeat("a", 2048)), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets", "application-abc.js.gz"), []byte(strings.Repeat("z", 100)), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets", "application-def.css"), []byte(strings.Repeat("b", 512)), 0600)).To(Succeed())
+		})
+
+		it("measures the files listed in the manifests", func() {
+			sizes, err := railsassets.MeasureAssets(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			summary := railsassets.SummarizeAssets(sizes)
+
+			Expect(summary.Count).To(Equal(2))
+			Expect(summary.Bytes).To(Equal(int64(2560)))
+			Expect(summary.Largest).To(HaveLen(2))
+
+			Expect(summary.Largest[0]).To(Equal(railsassets.AssetSize{
+				LogicalPath:     "application.js",
+				File:            filepath.Join("public", "assets", "application-abc.js"),
+				Bytes:           2048,
+				CompressedBytes: 100,
+			}))
+
+			Expect(summary.Largest[1].LogicalPath).To(Equal("application.css"))
+			Expect(summary.Largest[1].Bytes).To(Equal(int64(512)))
+			Expect(summary.Largest[1].CompressedBytes).To(BeNumerically(">", 0))
+			Expect(summary.Largest[1].CompressedBytes).To(BeNumerically("<", 512))
+
+			Expect(summary.CompressedBytes).To(Equal(100 + summary.Largest[1].CompressedBytes))
+		})
+
+		context("when there are more than ten assets", func() {
+			it.Before(func() {
+				var entries []string
+				for i := 1; i <= 12; i++ {
+					entries = append(entries, fmt.Sprintf(`"asset%d.js": "asset%d-abc.js"`, i, i))
+					Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets", fmt.Sprintf("asset%d-abc.js", i)), []byte(strings.Repeat("a", i)), 0600)).To(Succeed())
+				}
+
+				Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets", ".manifest.json"), []byte("{"+strings.Join(entries, ",")+"}"), 0600)).To(Succeed())
+			})
+
+			it("keeps the ten largest", func() {
+				sizes, err := railsassets.MeasureAssets(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				summary := railsassets.SummarizeAssets(sizes)
+
+				Expect(summary.Count).To(Equal(12))
+				Expect(summary.Largest).To(HaveLen(10))
+				Expect(summary.Largest[0].LogicalPath).To(Equal("asset12.js"))
+				Expect(summary.Largest[9].LogicalPath).To(Equal("asset3.js"))
+			})
+		})
+
+		context("when a manifest does not parse", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets", ".manifest.json"), []byte(`{`), 0600)).To(Succeed())
+			})
+
+			it("leaves it out", func() {
+				sizes, err := railsassets.MeasureAssets(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				summary := railsassets.SummarizeAssets(sizes)
+				Expect(summary.Count).To(Equal(0))
+			})
+		})
+	})
+
+	context("Metadata", func() {
+		it("returns a compact form of the summary", func() {
+			summary := railsassets.AssetSummary{
+				Count:           2,
+				Bytes:           30,
+				CompressedBytes: 12,
+				Largest: []railsassets.AssetSize{
+					{LogicalPath: "application.js", Bytes: 20, CompressedBytes: 8},
+				},
+			}
+
+			Expect(summary.Metadata()).To(Equal(map[string]interface{}{
+				"count":            2,
+				"bytes":            int64(30),
+				"compressed_bytes": int64(12),
+				"largest": []map[string]interface{}{
+					{"logical_path": "application.js", "bytes": int64(20), "compressed_bytes": int64(8)},
+				},
+			}))
+		})
+
+		context("when images were optimized", func() {
+			it("records the bytes that were saved", func() {
+				summary := railsassets.AssetSummary{ImageBytesSaved: 512}
+
+				Expect(summary.Metadata()).To(HaveKeyWithValue("image_bytes_saved", int64(512)))
+			})
+		})
+	})
+}
@@ -1,8 +1,12 @@
 package railsassets
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/paketo-buildpacks/packit/v2"
@@ -14,6 +18,21 @@ const (
 	// LayerNameAssets is the name of the layer that is used to store asset
 	// contents.
 	LayerNameAssets = "assets"
+
+	// LayerNameEnvironment is the name of the layer that holds the launch
+	// environment when the "assets" layer is not available at launch, as is
+	// the case with the "copy" link mode.
+	LayerNameEnvironment = "environment"
+
+	// LayerNameSourceMaps is the name of the layer that holds the source maps
+	// with the "separate" source map policy. It is available to later
+	// buildpacks, but not at launch.
+	LayerNameSourceMaps = "source-maps"
+
+	// LayerNameExport is the name of the layer that holds the compiled assets
+	// exported for publishing to a CDN. It is available to later buildpacks,
+	// but not at launch.
+	LayerNameExport = "assets-export"
 )
 
 //go:generate faux --interface BuildProcess --output fakes/build_process.go
@@ -23,7 +42,7 @@ const (
 // BuildProcess defines the interface for executing the "rails
 // assets:precompile" build process.
 type BuildProcess interface {
-	Execute(workingDir string) error
+	Execute(workingDir, platformDir string) error
 }
 
 // Calculator defines the interface for calculating a checksum of a given set
@@ -36,8 +55,11 @@ type Calculator interface {
 // and linking into layers created by the build phase.
 type EnvironmentSetup interface {
 	ResetLocal(workingDir string) error
-	ResetLayer(layerPath string) error
+	ResetLayer(layerPath, workingDir string) error
 	Link(layerPath, workingDir string) error
+	Materialize(layerPath, workingDir string) error
+	PreserveCommitted(workingDir, stagingDir string) error
+	RestoreCommitted(stagingDir, layerPath string) error
 }
 
 // Build will return a packit.BuildFunc that will be invoked during the build
@@ -45,26 +67,69 @@ type EnvironmentSetup interface {
 //
 // Build will perform the following steps to execute its build process:
 //   1. Reset the local working directory locations that will be modified by
-//   the buildpack. These locations include public/assets and tmp/cache and all
-//   extra directories defined by the user.
+//   the buildpack. These locations include public/assets and tmp/cache, the
+//   directories discovered from the application configuration, and all extra
+//   directories defined by the user. Files committed to these locations are
+//   listed in a warning, or preserved when
+//   $BP_RAILS_ASSETS_PRESERVE_COMMITTED is set.
 //   2. Calculate a checksum of the asset directories that appear in the
 //   working directory. These directories include app/assets, lib/assets,
 //   vendor/assets, app/javascript, and the user defined checksum directories.
-//   3. Compare the calculated checksum against the recorded value on the
-//   "assets" layer metadata.
-//   3a. If the checksum matches the recorded value, the build process
-//   completes without modifying the existing layer contents.
-//   4. If the checksum does not match, then the "assets" layer contents are
-//   cleared.
-//   5. The "rails assets:precompile" build process is executed.
+//   For Vite Ruby applications, the source code directory, config/vite.json
+//   and vite.config.* are also included. For jsbundling-rails and
+//   cssbundling-rails applications, the generated app/assets/builds
+//   directory is excluded. Literal additions to config.assets.paths are
+//   also included. The pre- and post-precompile
+//   commands, the post-processing settings and any preserved committed files
+//   are included in the checksum.
+//   3. Compare the calculated checksum, and the layout of the layer
+//   (destination paths, link mode and asset pipelines), against the recorded
+//   values on the "assets" layer metadata.
+//   3a. If both match the recorded values, and the manifests in a cached
+//   layer list only files that exist, the build process
+//   completes without modifying the existing layer contents. The cached
+//   assets are still checked against the size budgets (see 5c).
+//   4. If either does not match, then the output of the previous build is
+//   removed from the "assets" layer, keeping only the caches under tmp,
+//   directories that are no longer configured are removed, and any
+//   preserved committed files are restored into it.
+//   5. The "rails assets:precompile" build process is executed, and its output
+//   is verified: each expected manifest must exist and parse, every file it
+//   lists must exist, and the output directories must not be empty. Problems
+//   fail the build, or are only logged when $BP_RAILS_ASSETS_VERIFY=warn.
+//   For jsbundling-rails and cssbundling-rails applications, app/assets/builds
+//   must contain generated output, which is then removed unless
+//   $BP_RAILS_ASSETS_KEEP_BUILDS is true.
+//   5a. With $BP_RAILS_ASSETS_SOURCE_MAPS=strip or separate, the source maps
+//   are removed from the compiled output, or moved to the "source-maps"
+//   layer, along with the comments that refer to them. When
+//   $BP_RAILS_ASSETS_OPTIMIZE_IMAGES is set, the compiled PNG, JPEG
+//   and GIF files are losslessly optimized in place. When
+//   $BP_RAILS_ASSETS_PRECOMPRESS is set, gzip and brotli variants
+//   are written next to the compressible compiled assets that lack them.
+//   5b. The compiled assets listed in the manifests are summarized in the log
+//   and in the layer metadata: their number, total and compressed size, the
+//   largest assets, and the bytes saved by optimizing images.
+//   5c. The compiled assets are checked against the size budgets defined in
+//   config/asset_budgets.yml and $BP_RAILS_ASSETS_BUDGETS. Assets over budget
+//   fail the build, or are only logged when
+//   $BP_RAILS_ASSETS_BUDGETS_MODE=warn.
+//   5d. With $BP_RAILS_ASSETS_EXPORT set, the compiled assets and an index
+//   describing them are exported to the "assets-export" layer, and copied to
+//   $BP_RAILS_ASSETS_EXPORT_PATH when it is set.
 //   6. The launch environment is configured with the following environment variables:
 //      * RAILS_ENV=production : run Rails in its "production" configuration
 //      * RAILS_SERVE_STATIC_FILES : configure Rails to serve static files
 //      itself instead of expecting that a file server like NGINX will serve
 //      them
 //      * RAILS_LOG_TO_STDOUT=true : Rails will log to stdout
+//      * ASSET_HOST : the value of $BP_RAILS_ASSETS_ASSET_HOST, when it is set
 //   7. Attach build metadata onto the new "assets" layer so that it can be
 //   referenced in future builds.
+//   8. With the "copy" link mode, the linked directories are replaced with
+//   copies of the "assets" layer contents. The "assets" layer is then only
+//   used as a cache and the launch environment is set on a separate
+//   "environment" layer.
 func Build(
 	buildProcess BuildProcess,
 	calculator Calculator,
@@ -75,7 +140,99 @@ func Build(
 	return func(context packit.BuildContext) (packit.BuildResult, error) {
 		logger.Title("%s %s", context.BuildpackInfo.Name, context.BuildpackInfo.Version)
 
-		err := environmentSetup.ResetLocal(context.WorkingDir)
+		linkMode, err := ParseLinkMode()
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		warnOnly, err := parseVerifyMode()
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		precompressFormats, err := ParsePrecompressFormats()
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		precompressMinSize, err := ParsePrecompressMinSize()
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		sourceMaps, err := ParseSourceMapPolicy()
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		sourceMapsExportPath := os.Getenv("BP_RAILS_ASSETS_SOURCE_MAPS_PATH")
+		if sourceMapsExportPath != "" && !filepath.IsAbs(sourceMapsExportPath) {
+			return packit.BuildResult{}, fmt.Errorf("invalid BP_RAILS_ASSETS_SOURCE_MAPS_PATH %q: must be an absolute path", sourceMapsExportPath)
+		}
+
+		exportFormat, err := ParseExportFormat()
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		exportPath := os.Getenv("BP_RAILS_ASSETS_EXPORT_PATH")
+		if exportPath != "" && !filepath.IsAbs(exportPath) {
+			return packit.BuildResult{}, fmt.Errorf("invalid BP_RAILS_ASSETS_EXPORT_PATH %q: must be an absolute path", exportPath)
+		}
+
+		optimizeImages, err := parseBoolEnv("BP_RAILS_ASSETS_OPTIMIZE_IMAGES")
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		budgets, err := ParseAssetBudgets(context.WorkingDir)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		warnOverBudget, err := parseBudgetsMode()
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		discovered, err := DiscoverDestinationPaths(context.WorkingDir)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		if len(discovered) > 0 {
+			logger.Process("Discovered asset destination paths:")
+			for _, path := range discovered {
+				logger.Subprocess("%s (from %s)", path.Path, path.Source)
+			}
+			logger.Break()
+		}
+
+		keepBuilds, err := parseBoolEnv("BP_RAILS_ASSETS_KEEP_BUILDS")
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		preserveCommitted, err := parseBoolEnv("BP_RAILS_ASSETS_PRESERVE_COMMITTED")
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		var committedDir string
+		if preserveCommitted {
+			committedDir, err = os.MkdirTemp("", "committed-assets")
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+			defer os.RemoveAll(committedDir)
+
+			err = environmentSetup.PreserveCommitted(context.WorkingDir, committedDir)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
+		err = environmentSetup.ResetLocal(context.WorkingDir)
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
@@ -90,11 +247,58 @@ func Build(
 			filepath.Join(context.WorkingDir, "app", "javascript"),
 		}
 
+		lock, err := NewGemfileLockParser().Parse(filepath.Join(context.WorkingDir, "Gemfile.lock"))
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		if usesBundling(lock) {
+			paths, err = excludeBuildsDirectory(context.WorkingDir, paths)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
+		vite, ok, err := ParseViteConfig(context.WorkingDir, lock)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		if ok {
+			paths = append(paths,
+				filepath.Join(context.WorkingDir, vite.SourceCodeDir),
+				filepath.Join(context.WorkingDir, vite.ConfigPath),
+			)
+		}
+
+		viteConfigs, err := filepath.Glob(filepath.Join(context.WorkingDir, "vite.config.*"))
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+		paths = append(paths, viteConfigs...)
+
+		sourcePaths, unresolved, err := DiscoverSourcePaths(context.WorkingDir)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		for _, path := range sourcePaths {
+			paths = append(paths, filepath.Join(context.WorkingDir, path.Path))
+		}
+
+		for _, path := range unresolved {
+			logger.Debug.Subprocess("Unable to resolve config.assets.paths entry %s in %s", path.Expression, path.Source)
+		}
+
 		extraPaths := filepath.SplitList(os.Getenv("BP_RAILS_ASSETS_EXTRA_SOURCE_PATHS"))
 		for _, path := range extraPaths {
 			paths = append(paths, filepath.Join(context.WorkingDir, filepath.Clean(path)))
 		}
 
+		if preserveCommitted {
+			paths = append(paths, committedDir)
+		}
+
 		for _, path := range paths {
 			if _, err := os.Stat(path); err == nil {
 				logger.Debug.Subprocess(path)
@@ -107,6 +311,13 @@ func Build(
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
+		sum = withHookCommands(sum)
+		sum = withPostProcessing(sum)
+
+		layout, err := ResolveLayerLayout(context.WorkingDir)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
 
 		logger.Debug.Process("Getting the layer associated with Rails assets:")
 		assetsLayer, err := context.Layers.Get(LayerNameAssets)
@@ -117,27 +328,125 @@ func Build(
 		logger.Debug.Break()
 
 		previousSum, _ := assetsLayer.Metadata["cache_sha"].(string)
-		if sum == previousSum {
-			logger.Process("Reusing cached layer %s", assetsLayer.Path)
+		reusable := sum == previousSum
 
-			assetsLayer.Launch = true
-			logger.Debug.Process("Symlinking asset directories to %s", context.WorkingDir)
+		var extraLayers []packit.Layer
+		var sourceMapsLayer packit.Layer
+		if sourceMaps == SourceMapsSeparate {
+			sourceMapsLayer, err = context.Layers.Get(LayerNameSourceMaps)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			if previousSum, _ := sourceMapsLayer.Metadata["cache_sha"].(string); reusable && previousSum != sum {
+				logger.Process("Cached source maps are missing; rebuilding %s", assetsLayer.Path)
+				logger.Break()
+				reusable = false
+			}
+		}
+
+		var exportLayer packit.Layer
+		if exportFormat != "" {
+			exportLayer, err = context.Layers.Get(LayerNameExport)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			if previousSum, _ := exportLayer.Metadata["cache_sha"].(string); reusable && previousSum != sum {
+				logger.Process("Cached asset export is missing; rebuilding %s", assetsLayer.Path)
+				logger.Break()
+				reusable = false
+			}
+		}
+
+		if reusable && !layout.Matches(assetsLayer.Metadata) {
+			logger.Process("Asset layer layout has changed; rebuilding %s", assetsLayer.Path)
 			logger.Break()
+			reusable = false
+		}
+
+		if reusable {
+			logger.Debug.Process("Symlinking asset directories to %s", context.WorkingDir)
 			err = environmentSetup.Link(assetsLayer.Path, context.WorkingDir)
 			if err != nil {
 				return packit.BuildResult{}, err
 			}
 
+			problems, err := VerifyAssets(context.WorkingDir, time.Time{})
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			if len(problems) > 0 {
+				logger.Process("Cached layer %s failed verification and must be rebuilt:", assetsLayer.Path)
+				logProblems(logger, problems)
+				logger.Break()
+				reusable = false
+
+				assetsLayer, err = assetsLayer.Reset()
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+			}
+		}
+
+		if reusable && len(budgets) > 0 {
+			sizes, err := MeasureAssets(context.WorkingDir)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			err = checkBudgets(logger, budgets, sizes, warnOverBudget)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
+		if reusable {
+			logger.Process("Reusing cached layer %s", assetsLayer.Path)
+			logger.Break()
+
+			assetsLayer.Metadata["layout"] = layout.Metadata()
+			assetsLayer.Launch = true
+			assetsLayer.Cache = true
+
+			if sourceMaps == SourceMapsSeparate {
+				sourceMapsLayer, err = exportSourceMaps(sourceMapsLayer, sum, sourceMapsExportPath, logger)
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+				extraLayers = append(extraLayers, sourceMapsLayer)
+			}
+
+			if exportFormat != "" {
+				exportLayer, err = publishExport(exportLayer, sum, exportFormat, exportPath, logger)
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+				extraLayers = append(extraLayers, exportLayer)
+			}
+
+			if linkMode == LinkModeCopy {
+				return copyAssets(context, assetsLayer, extraLayers, environmentSetup, logger)
+			}
+
 			return packit.BuildResult{
-				Layers: []packit.Layer{assetsLayer},
+				Layers: append([]packit.Layer{assetsLayer}, extraLayers...),
 			}, nil
 		}
 
-		err = environmentSetup.ResetLayer(assetsLayer.Path)
+		err = environmentSetup.ResetLayer(assetsLayer.Path, context.WorkingDir)
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
 
+		if preserveCommitted {
+			err = environmentSetup.RestoreCommitted(committedDir, assetsLayer.Path)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
 		logger.Debug.Process("Symlinking asset directories to %s", context.WorkingDir)
 		err = environmentSetup.Link(assetsLayer.Path, context.WorkingDir)
 		if err != nil {
@@ -145,8 +454,9 @@ func Build(
 		}
 
 		logger.Process("Executing build process")
+		compiledAt := clock.Now()
 		duration, err := clock.Measure(func() error {
-			return buildProcess.Execute(context.WorkingDir)
+			return buildProcess.Execute(context.WorkingDir, context.Platform.Path)
 		})
 		if err != nil {
 			return packit.BuildResult{}, err
@@ -155,18 +465,390 @@ func Build(
 		logger.Action("Completed in %s", duration.Round(time.Millisecond))
 		logger.Break()
 
+		problems, err := VerifyAssets(context.WorkingDir, compiledAt)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		if len(problems) > 0 {
+			if !warnOnly {
+				return packit.BuildResult{}, fmt.Errorf("the compiled assets failed verification:\n  %s\nset $BP_RAILS_ASSETS_VERIFY=warn to continue anyway", strings.Join(problems, "\n  "))
+			}
+
+			logger.Process("Warning: the compiled assets failed verification:")
+			logProblems(logger, problems)
+			logger.Break()
+		}
+
+		if usesBundling(lock) && !keepBuilds {
+			removed, err := cleanBuildsDirectory(context.WorkingDir)
+			if err != nil {
+				return packit.BuildResult{}, fmt.Errorf("failed to clean app/assets/builds: %w", err)
+			}
+
+			if len(removed) > 0 {
+				logger.Process("Removed %d generated entries from app/assets/builds", len(removed))
+				for _, name := range removed {
+					logger.Debug.Subprocess("%s", name)
+				}
+				logger.Break()
+			}
+		}
+
+		if sourceMaps != SourceMapsKeep {
+			var destination string
+			if sourceMaps == SourceMapsSeparate {
+				sourceMapsLayer, err = sourceMapsLayer.Reset()
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+				destination = sourceMapsLayer.Path
+			}
+
+			logger.Process("Removing source maps")
+			result, err := RemoveSourceMaps(context.WorkingDir, destination)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			if destination != "" {
+				logger.Subprocess("Moved %d source map(s) to %s", result.Maps, destination)
+			} else {
+				logger.Subprocess("Removed %d source map(s)", result.Maps)
+			}
+			logger.Subprocess("Removed the sourceMappingURL comments from %d file(s)", result.Comments)
+			logger.Break()
+
+			if sourceMaps == SourceMapsSeparate {
+				sourceMapsLayer, err = exportSourceMaps(sourceMapsLayer, sum, sourceMapsExportPath, logger)
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+				extraLayers = append(extraLayers, sourceMapsLayer)
+			}
+		}
+
+		var optimized ImageOptimizationResult
+		if optimizeImages {
+			logger.Process("Optimizing images")
+
+			duration, err := clock.Measure(func() error {
+				optimized, err = OptimizeImages(context.WorkingDir)
+				return err
+			})
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			logger.Subprocess("Optimized %d image(s), saving %s", optimized.Files, formatBytes(optimized.Bytes))
+			logger.Action("Completed in %s", duration.Round(time.Millisecond))
+			logger.Break()
+		}
+
+		if len(precompressFormats) > 0 {
+			logger.Process("Precompressing assets")
+
+			var result PrecompressResult
+			duration, err := clock.Measure(func() error {
+				result, err = PrecompressAssets(context.WorkingDir, precompressFormats, precompressMinSize)
+				return err
+			})
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			for _, format := range precompressFormats {
+				logger.Subprocess("Wrote %d %s file(s)", result[format], format)
+			}
+			logger.Action("Completed in %s", duration.Round(time.Millisecond))
+			logger.Break()
+		}
+
+		sizes, err := MeasureAssets(context.WorkingDir)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		summary := SummarizeAssets(sizes)
+		summary.ImageBytesSaved = optimized.Bytes
+		logSummary(logger, summary, assetsLayer.Metadata)
+
+		err = checkBudgets(logger, budgets, sizes, warnOverBudget)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		if exportFormat != "" {
+			exportLayer, err = exportLayer.Reset()
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			logger.Process("Exporting assets")
+			index, err := ExportAssets(context.WorkingDir, exportLayer.Path, exportFormat)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+			logger.Subprocess("Exported %d file(s) to %s", len(index.Assets), exportLayer.Path)
+			logger.Break()
+
+			exportLayer, err = publishExport(exportLayer, sum, exportFormat, exportPath, logger)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+			extraLayers = append(extraLayers, exportLayer)
+		}
+
 		assetsLayer.Launch = true
-		assetsLayer.LaunchEnv.Default("RAILS_ENV", "production")
-		assetsLayer.LaunchEnv.Default("RAILS_SERVE_STATIC_FILES", "true")
-		assetsLayer.LaunchEnv.Default("RAILS_LOG_TO_STDOUT", "true")
+		assetsLayer.Cache = true
+		setLaunchEnv(assetsLayer.LaunchEnv)
 		logger.EnvironmentVariables(assetsLayer)
 
 		assetsLayer.Metadata = map[string]interface{}{
-			"cache_sha": sum,
+			"cache_sha":        sum,
+			"layout":           layout.Metadata(),
+			"summary":          summary.Metadata(),
+		}
+
+		if linkMode == LinkModeCopy {
+			return copyAssets(context, assetsLayer, extraLayers, environmentSetup, logger)
 		}
 
 		return packit.BuildResult{
-			Layers: []packit.Layer{assetsLayer},
+			Layers: append([]packit.Layer{assetsLayer}, extraLayers...),
 		}, nil
 	}
 }
+
+// withHookCommands folds the configured pre- and post-precompile commands into
+// the checksum so that changing them invalidates the cached layer.
+func withHookCommands(sum string) string {
+	preCommand := hookCommand("BP_RAILS_ASSETS_PRE_COMMANDS")
+	postCommand := hookCommand("BP_RAILS_ASSETS_POST_COMMANDS")
+	if preCommand == "" && postCommand == "" {
+		return sum
+	}
+
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s\npre:%q\npost:%q\n", sum, preCommand, postCommand)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// postProcessingSettings are the variables that configure how the compiled
+// assets are processed after the precompile. The asset host is included
+// because the launch environment of a reused layer cannot be changed.
+var postProcessingSettings = []string{
+	"BP_RAILS_ASSETS_PRECOMPRESS",
+	"BP_RAILS_ASSETS_PRECOMPRESS_MIN_SIZE",
+	"BP_RAILS_ASSETS_OPTIMIZE_IMAGES",
+	"BP_RAILS_ASSETS_SOURCE_MAPS",
+	"BP_RAILS_ASSETS_EXPORT",
+	"BP_RAILS_ASSETS_ASSET_HOST",
+}
+
+// withPostProcessing folds the post-processing settings into the checksum so
+// that changing them invalidates the cached layer.
+func withPostProcessing(sum string) string {
+	var settings []string
+	for _, name := range postProcessingSettings {
+		if value, ok := os.LookupEnv(name); ok && value != "" {
+			settings = append(settings, fmt.Sprintf("%s=%s", name, value))
+		}
+	}
+
+	if len(settings) == 0 {
+		return sum
+	}
+
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s\nsettings:%q\n", sum, settings)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// logSummary logs the number and size of the compiled assets, the change in
+// size since the build recorded in the previous metadata, and the largest
+// assets.
+func logSummary(logger scribe.Emitter, summary AssetSummary, previous map[string]interface{}) {
+	if summary.Count == 0 {
+		return
+	}
+
+	logger.Process("Compiled assets")
+	logger.Subprocess("%d assets, %s (%s compressed)", summary.Count, formatBytes(summary.Bytes), formatBytes(summary.CompressedBytes))
+
+	if recorded, ok := previous["summary"].(map[string]interface{}); ok {
+		if bytes, ok := recorded["bytes"].(int64); ok {
+			delta := summary.Bytes - bytes
+			sign := "+"
+			if delta < 0 {
+				sign, delta = "-", -delta
+			}
+			logger.Subprocess("%s%s since the previous build", sign, formatBytes(delta))
+		}
+	}
+
+	if summary.ImageBytesSaved > 0 {
+		logger.Subprocess("%s saved by optimizing images", formatBytes(summary.ImageBytesSaved))
+	}
+
+	logger.Subprocess("Largest assets:")
+	for _, size := range summary.Largest {
+		logger.Action("%s: %s (%s compressed)", size.LogicalPath, formatBytes(size.Bytes), formatBytes(size.CompressedBytes))
+	}
+	logger.Break()
+}
+
+// parseVerifyMode reads $BP_RAILS_ASSETS_VERIFY, which is either "fail" (the
+// default) or "warn", and reports whether verification problems should only
+// be logged.
+func parseVerifyMode() (bool, error) {
+	switch mode := os.Getenv("BP_RAILS_ASSETS_VERIFY"); mode {
+	case "", "fail":
+		return false, nil
+	case "warn":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid BP_RAILS_ASSETS_VERIFY %q: must be %q or %q", mode, "fail", "warn")
+	}
+}
+
+// parseBudgetsMode reads $BP_RAILS_ASSETS_BUDGETS_MODE, which is either
+// "fail" (the default) or "warn", and reports whether assets that exceed their
+// size budgets should only be logged.
+func parseBudgetsMode() (bool, error) {
+	switch mode := os.Getenv("BP_RAILS_ASSETS_BUDGETS_MODE"); mode {
+	case "", "fail":
+		return false, nil
+	case "warn":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid BP_RAILS_ASSETS_BUDGETS_MODE %q: must be %q or %q", mode, "fail", "warn")
+	}
+}
+
+// checkBudgets checks the compiled assets against their size budgets. Assets
+// over budget are returned as an error, or only logged when warnOnly is set.
+func checkBudgets(logger scribe.Emitter, budgets []AssetBudget, sizes []AssetSize, warnOnly bool) error {
+	violations := CheckAssetBudgets(budgets, sizes)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	table := formatBudgetViolations(violations)
+	if !warnOnly {
+		return fmt.Errorf("the compiled assets exceed their size budgets:\n  %s\nset $BP_RAILS_ASSETS_BUDGETS_MODE=warn to continue anyway", strings.Join(table, "\n  "))
+	}
+
+	logger.Process("Warning: the compiled assets exceed their size budgets:")
+	for _, line := range table {
+		logger.Subprocess("%s", line)
+	}
+	logger.Break()
+
+	return nil
+}
+
+// logProblems lists up to ten problems found while verifying the assets.
+func logProblems(logger scribe.Emitter, problems []string) {
+	for i, problem := range problems {
+		if i == 10 {
+			logger.Subprocess("... and %d more", len(problems)-i)
+			break
+		}
+		logger.Subprocess("%s", problem)
+	}
+}
+
+// setLaunchEnv sets the defaults of the launch environment, including
+// ASSET_HOST when $BP_RAILS_ASSETS_ASSET_HOST is set.
+func setLaunchEnv(env packit.Environment) {
+	env.Default("RAILS_ENV", "production")
+	env.Default("RAILS_SERVE_STATIC_FILES", "true")
+	env.Default("RAILS_LOG_TO_STDOUT", "true")
+
+	if assetHost := os.Getenv("BP_RAILS_ASSETS_ASSET_HOST"); assetHost != "" {
+		env.Default("ASSET_HOST", assetHost)
+	}
+}
+
+// copyAssets copies the contents of the "assets" layer into the working
+// directory, keeps the layer as a cache only, and moves the launch environment
+// onto the "environment" layer.
+func copyAssets(context packit.BuildContext, assetsLayer packit.Layer, extraLayers []packit.Layer, environmentSetup EnvironmentSetup, logger scribe.Emitter) (packit.BuildResult, error) {
+	logger.Process("Copying assets into %s", context.WorkingDir)
+	logger.Break()
+
+	err := environmentSetup.Materialize(assetsLayer.Path, context.WorkingDir)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+
+	environmentLayer, err := context.Layers.Get(LayerNameEnvironment)
+	if err != nil {
+		return packit.BuildResult{}, err
+	}
+
+	environmentLayer.Launch = true
+	setLaunchEnv(environmentLayer.LaunchEnv)
+
+	assetsLayer.Launch = false
+	assetsLayer.Cache = true
+	assetsLayer.LaunchEnv = packit.Environment{}
+
+	return packit.BuildResult{
+		Layers: append([]packit.Layer{assetsLayer, environmentLayer}, extraLayers...),
+	}, nil
+}
+
+// exportSourceMaps makes the "source-maps" layer available to later
+// buildpacks, which find it through $RAILS_ASSETS_SOURCE_MAPS_DIR, and caches
+// it alongside the "assets" layer. When an export path is given, the source
+// maps are also copied there.
+func exportSourceMaps(layer packit.Layer, sum, exportPath string, logger scribe.Emitter) (packit.Layer, error) {
+	layer.Build = true
+	layer.Cache = true
+	layer.BuildEnv.Default("RAILS_ASSETS_SOURCE_MAPS_DIR", layer.Path)
+	layer.Metadata = map[string]interface{}{
+		"cache_sha": sum,
+	}
+
+	if exportPath != "" {
+		logger.Process("Exporting source maps to %s", exportPath)
+		logger.Break()
+
+		err := copyTree(layer.Path, exportPath)
+		if err != nil {
+			return packit.Layer{}, fmt.Errorf("failed to export source maps: %w", err)
+		}
+	}
+
+	return layer, nil
+}
+
+// publishExport makes the "assets-export" layer available to later
+// buildpacks, which find it through $RAILS_ASSETS_EXPORT_DIR, and caches it
+// alongside the "assets" layer. When an export path is given, the export is
+// also copied there.
+func publishExport(layer packit.Layer, sum string, format ExportFormat, exportPath string, logger scribe.Emitter) (packit.Layer, error) {
+	layer.Build = true
+	layer.Cache = true
+	layer.BuildEnv.Default("RAILS_ASSETS_EXPORT_DIR", layer.Path)
+	layer.Metadata = map[string]interface{}{
+		"cache_sha": sum,
+		"format":    string(format),
+	}
+
+	if exportPath != "" {
+		logger.Process("Copying the asset export to %s", exportPath)
+		logger.Break()
+
+		err := copyTree(layer.Path, exportPath)
+		if err != nil {
+			return packit.Layer{}, fmt.Errorf("failed to copy the asset export: %w", err)
+		}
+	}
+
+	return layer, nil
+}
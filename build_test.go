@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/chronos"
@@ -76,6 +78,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			WorkingDir: workingDir,
 			CNBPath:    cnbDir,
 			Stack:      "some-stack",
+			Platform:   packit.Platform{Path: "some-platform-path"},
 			Layers:     packit.Layers{Path: layersDir},
 			BuildpackInfo: packit.BuildpackInfo{
 				Name:    "Some Buildpack",
@@ -89,6 +92,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 					Path:      filepath.Join(layersDir, "assets"),
 					Name:      "assets",
 					Launch:    true,
+					Cache:     true,
 					SharedEnv: packit.Environment{},
 					BuildEnv:  packit.Environment{},
 					LaunchEnv: packit.Environment{
@@ -99,6 +103,17 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 					ProcessLaunchEnv: map[string]packit.Environment{},
 					Metadata: map[string]interface{}{
 						"cache_sha": "some-calculator-sha",
+						"layout": map[string]interface{}{
+							"destination_paths": []string{"public/assets", "public/packs", "tmp/cache/assets"},
+							"link_mode":         "symlink",
+							"pipelines":         []string{},
+						},
+						"summary": map[string]interface{}{
+							"count":            0,
+							"bytes":            int64(0),
+							"compressed_bytes": int64(0),
+							"largest":          []map[string]interface{}{},
+						},
 					},
 				},
 			},
@@ -106,6 +121,10 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 
 		Expect(buildProcess.ExecuteCall.CallCount).To(Equal(1))
 		Expect(buildProcess.ExecuteCall.Receives.WorkingDir).To(Equal(workingDir))
+		Expect(buildProcess.ExecuteCall.Receives.PlatformDir).To(Equal("some-platform-path"))
+
+		Expect(environmentSetup.ResetLayerCall.Receives.LayerPath).To(Equal(filepath.Join(layersDir, "assets")))
+		Expect(environmentSetup.ResetLayerCall.Receives.WorkingDir).To(Equal(workingDir))
 
 		Expect(buffer.String()).To(ContainSubstring("Some Buildpack some-version"))
 		Expect(buffer.String()).To(ContainSubstring("Executing build process"))
@@ -114,6 +133,30 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		Expect(buffer.String()).To(ContainSubstring(`RAILS_SERVE_STATIC_FILES -> "true"`))
 	})
 
+	context("when the app configures its own destination paths", func() {
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(workingDir, "config"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "config", "application.rb"), []byte(`config.assets.prefix = "/static"`), 0600)).To(Succeed())
+		})
+
+		it("logs each discovered path with its source", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				Layers:     packit.Layers{Path: layersDir},
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring("Discovered asset destination paths:"))
+			Expect(buffer.String()).To(ContainSubstring("public/static (from config.assets.prefix in config/application.rb)"))
+		})
+	})
+
 	context("when checksum matches", func() {
 		it.Before(func() {
 			err := os.WriteFile(filepath.Join(layersDir, fmt.Sprintf("%s.toml", railsassets.LayerNameAssets)), []byte(`
@@ -151,6 +194,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 						Path:      filepath.Join(layersDir, "assets"),
 						Name:      "assets",
 						Launch:    true,
+						Cache:     true,
 						SharedEnv: packit.Environment{},
 						BuildEnv:  packit.Environment{},
 						LaunchEnv: packit.Environment{
@@ -160,6 +204,11 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 						ProcessLaunchEnv: map[string]packit.Environment{},
 						Metadata: map[string]interface{}{
 							"cache_sha": "some-calculator-sha",
+							"layout": map[string]interface{}{
+								"destination_paths": []string{"public/assets", "public/packs", "tmp/cache/assets"},
+								"link_mode":         "symlink",
+								"pipelines":         []string{},
+							},
 						},
 					},
 				},
@@ -280,6 +329,250 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			})
 		})
 
+		context("when the app uses jsbundling-rails or cssbundling-rails", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    jsbundling-rails (1.3.0)\n"), 0600)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(workingDir, "app", "assets", "builds"), os.ModePerm)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(workingDir, "app", "assets", "stylesheets"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "app", "assets", "config.js"), []byte(""), 0600)).To(Succeed())
+			})
+
+			it("excludes app/assets/builds from the checksum", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(calculator.SumCall.Receives.Paths).To(Equal([]string{
+					filepath.Join(workingDir, "app", "assets", "config.js"),
+					filepath.Join(workingDir, "app", "assets", "stylesheets"),
+				}))
+			})
+		})
+
+		context("when the app adds to config.assets.paths", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(workingDir, "config"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "config", "application.rb"), []byte(`
+config.assets.paths << Rails.root.join("app", "frontend")
+config.assets.paths << some_helper_path
+`), 0600)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(workingDir, "app", "frontend"), os.ModePerm)).To(Succeed())
+
+				build = railsassets.Build(buildProcess, calculator, environmentSetup, scribe.NewEmitter(buffer).WithLevel("DEBUG"), clock)
+			})
+
+			it("includes those paths in the checksum and reports the ones it cannot resolve", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(calculator.SumCall.Receives.Paths).To(Equal([]string{
+					filepath.Join(workingDir, "app", "assets"),
+					filepath.Join(workingDir, "app", "frontend"),
+				}))
+				Expect(buffer.String()).To(ContainSubstring("Unable to resolve config.assets.paths entry some_helper_path in config/application.rb"))
+			})
+		})
+
+		context("when the app uses vite ruby", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    vite_ruby (3.5.0)\n"), 0600)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(workingDir, "app", "frontend"), os.ModePerm)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(workingDir, "config"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "config", "vite.json"), []byte("{}"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "vite.config.ts"), []byte(""), 0600)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(workingDir, "public", "vite", ".vite"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "public", "vite", ".vite", "manifest.json"), []byte(`{"application.js": {"file": "assets/application-abc123.js"}}`), 0600)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(workingDir, "public", "vite", "assets"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "public", "vite", "assets", "application-abc123.js"), []byte("console.log('hello')"), 0600)).To(Succeed())
+
+				err := os.WriteFile(filepath.Join(layersDir, fmt.Sprintf("%s.toml", railsassets.LayerNameAssets)), []byte(`
+[metadata]
+	cache_sha = "some-calculator-sha"
+	[metadata.layout]
+		destination_paths = ["public/assets", "public/packs", "tmp/cache/assets", "public/vite"]
+		link_mode = "symlink"
+		pipelines = ["vite"]
+			`), 0600)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			it("includes the vite sources and config in the checksum", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(calculator.SumCall.Receives.Paths).To(Equal([]string{
+					filepath.Join(workingDir, "app", "assets"),
+					filepath.Join(workingDir, "app", "frontend"),
+					filepath.Join(workingDir, "config", "vite.json"),
+					filepath.Join(workingDir, "vite.config.ts"),
+				}))
+			})
+		})
+
+		context("when a file in the cached propshaft manifest is missing", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    propshaft (0.9.0)\n"), 0600)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(workingDir, "public", "assets"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets", ".manifest.json"), []byte(`{"application.css": "application-abc123.css"}`), 0600)).To(Succeed())
+
+				err := os.WriteFile(filepath.Join(layersDir, fmt.Sprintf("%s.toml", railsassets.LayerNameAssets)), []byte(`
+[metadata]
+	cache_sha = "some-calculator-sha"
+	[metadata.layout]
+		destination_paths = ["public/assets", "public/packs", "tmp/cache/assets"]
+		link_mode = "symlink"
+		pipelines = ["propshaft"]
+			`), 0600)
+				Expect(err).NotTo(HaveOccurred())
+
+				buildProcess.ExecuteCall.Stub = func(string, string) error {
+					return os.WriteFile(filepath.Join(workingDir, "public", "assets", "application-abc123.css"), nil, 0600)
+				}
+			})
+
+			it("verifies the restored layer and rebuilds it", func() {
+				result, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buildProcess.ExecuteCall.CallCount).To(Equal(1))
+				Expect(result.Layers[0].Launch).To(BeTrue())
+				Expect(result.Layers[0].Cache).To(BeTrue())
+
+				Expect(buffer.String()).To(ContainSubstring("failed verification and must be rebuilt:"))
+				Expect(buffer.String()).NotTo(ContainSubstring("Reusing cached layer"))
+			})
+		})
+
+		context("when there are pre- or post-precompile commands", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_PRE_COMMANDS", "rails js:routes")
+			})
+
+			it("includes them in the checksum and does not reuse the layer", func() {
+				result, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buildProcess.ExecuteCall.CallCount).To(Equal(1))
+				Expect(result.Layers[0].Metadata["cache_sha"]).NotTo(Equal("some-calculator-sha"))
+				Expect(result.Layers[0].Metadata["cache_sha"]).To(MatchRegexp(`^[0-9a-f]{64}$`))
+			})
+		})
+
+		context("when the assets are post-processed", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_PRECOMPRESS", "true")
+			})
+
+			it("includes the settings in the checksum and does not reuse the layer", func() {
+				result, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buildProcess.ExecuteCall.CallCount).To(Equal(1))
+				Expect(result.Layers[0].Metadata["cache_sha"]).NotTo(Equal("some-calculator-sha"))
+				Expect(result.Layers[0].Metadata["cache_sha"]).To(MatchRegexp(`^[0-9a-f]{64}$`))
+			})
+		})
+
+		context("when the recorded layout differs", func() {
+			it.Before(func() {
+				err := os.WriteFile(filepath.Join(layersDir, fmt.Sprintf("%s.toml", railsassets.LayerNameAssets)), []byte(`
+[metadata]
+	cache_sha = "some-calculator-sha"
+	[metadata.layout]
+		destination_paths = ["public/assets", "public/packs", "tmp/cache/assets"]
+		link_mode = "symlink"
+		pipelines = []
+			`), 0600)
+				Expect(err).NotTo(HaveOccurred())
+
+				t.Setenv("BP_RAILS_ASSETS_EXTRA_DESTINATION_PATHS", "public/widgets")
+			})
+
+			it("rebuilds the layer and records the new layout", func() {
+				result, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buildProcess.ExecuteCall.CallCount).To(Equal(1))
+				Expect(environmentSetup.ResetLayerCall.CallCount).To(Equal(1))
+				Expect(result.Layers[0].Metadata["layout"]).To(HaveKeyWithValue("destination_paths", []string{"public/assets", "public/packs", "tmp/cache/assets", "public/widgets"}))
+				Expect(buffer.String()).To(ContainSubstring("Asset layer layout has changed"))
+			})
+		})
+
+		context("when no layout was recorded and an extra destination path is added", func() {
+			it.Before(func() {
+				err := os.WriteFile(filepath.Join(layersDir, fmt.Sprintf("%s.toml", railsassets.LayerNameAssets)), []byte(`
+[metadata]
+	cache_sha = "some-calculator-sha"
+			`), 0600)
+				Expect(err).NotTo(HaveOccurred())
+
+				t.Setenv("BP_RAILS_ASSETS_EXTRA_DESTINATION_PATHS", "public/widgets")
+			})
+
+			it("rebuilds the layer", func() {
+				result, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buildProcess.ExecuteCall.CallCount).To(Equal(1))
+				Expect(result.Layers[0].Metadata["layout"]).To(HaveKeyWithValue("destination_paths", []string{"public/assets", "public/packs", "tmp/cache/assets", "public/widgets"}))
+				Expect(buffer.String()).To(ContainSubstring("Asset layer layout has changed"))
+			})
+		})
+
 		context("failure cases", func() {
 			context("when environment linking fails", func() {
 				it.Before(func() {
@@ -294,7 +587,888 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
-	context("failure cases", func() {
+	context("when committed files are preserved", func() {
+		it.Before(func() {
+			t.Setenv("BP_RAILS_ASSETS_PRESERVE_COMMITTED", "true")
+		})
+
+		it("stages them before resetting and restores them into the layer", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				Layers:     packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			stagingDir := environmentSetup.PreserveCommittedCall.Receives.StagingDir
+			Expect(environmentSetup.PreserveCommittedCall.CallCount).To(Equal(1))
+			Expect(environmentSetup.PreserveCommittedCall.Receives.WorkingDir).To(Equal(workingDir))
+			Expect(calculator.SumCall.Receives.Paths).To(ContainElement(stagingDir))
+
+			Expect(environmentSetup.RestoreCommittedCall.CallCount).To(Equal(1))
+			Expect(environmentSetup.RestoreCommittedCall.Receives.StagingDir).To(Equal(stagingDir))
+			Expect(environmentSetup.RestoreCommittedCall.Receives.LayerPath).To(Equal(filepath.Join(layersDir, "assets")))
+
+			Expect(stagingDir).NotTo(BeAnExistingFile())
+		})
+
+		context("failure cases", func() {
+			context("when preserving the committed files fails", func() {
+				it.Before(func() {
+					environmentSetup.PreserveCommittedCall.Returns.Error = errors.New("some-error")
+				})
+
+				it("returns the error", func() {
+					_, err := build(packit.BuildContext{WorkingDir: workingDir})
+					Expect(err).To(MatchError("some-error"))
+				})
+			})
+
+			context("when restoring the committed files fails", func() {
+				it.Before(func() {
+					environmentSetup.RestoreCommittedCall.Returns.Error = errors.New("some-error")
+				})
+
+				it("returns the error", func() {
+					_, err := build(packit.BuildContext{
+						WorkingDir: workingDir,
+						Layers:     packit.Layers{Path: layersDir},
+					})
+					Expect(err).To(MatchError("some-error"))
+				})
+			})
+		})
+	})
+
+	context("when the link mode is copy", func() {
+		it.Before(func() {
+			t.Setenv("BP_RAILS_ASSETS_LINK_MODE", "copy")
+		})
+
+		it("materializes the assets and only caches the assets layer", func() {
+			result, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				Layers:     packit.Layers{Path: layersDir},
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Layers).To(HaveLen(2))
+
+			assetsLayer := result.Layers[0]
+			Expect(assetsLayer.Name).To(Equal("assets"))
+			Expect(assetsLayer.Cache).To(BeTrue())
+			Expect(assetsLayer.Launch).To(BeFalse())
+			Expect(assetsLayer.LaunchEnv).To(BeEmpty())
+			Expect(assetsLayer.Metadata["cache_sha"]).To(Equal("some-calculator-sha"))
+			Expect(assetsLayer.Metadata["layout"]).To(HaveKeyWithValue("link_mode", "copy"))
+
+			environmentLayer := result.Layers[1]
+			Expect(environmentLayer.Name).To(Equal("environment"))
+			Expect(environmentLayer.Launch).To(BeTrue())
+			Expect(environmentLayer.LaunchEnv).To(Equal(packit.Environment{
+				"RAILS_ENV.default":                "production",
+				"RAILS_SERVE_STATIC_FILES.default": "true",
+				"RAILS_LOG_TO_STDOUT.default":      "true",
+			}))
+
+			Expect(environmentSetup.MaterializeCall.CallCount).To(Equal(1))
+			Expect(environmentSetup.MaterializeCall.Receives.LayerPath).To(Equal(filepath.Join(layersDir, "assets")))
+			Expect(environmentSetup.MaterializeCall.Receives.WorkingDir).To(Equal(workingDir))
+
+			Expect(buffer.String()).To(ContainSubstring("Copying assets into"))
+		})
+
+		context("when the checksum matches a layer built in copy mode", func() {
+			it.Before(func() {
+				result, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				err = os.WriteFile(filepath.Join(layersDir, fmt.Sprintf("%s.toml", railsassets.LayerNameAssets)), []byte(fmt.Sprintf(`
+[metadata]
+	cache_sha = %q
+	[metadata.layout]
+		destination_paths = ["public/assets", "public/packs", "tmp/cache/assets"]
+		link_mode = "copy"
+		pipelines = []
+			`, result.Layers[0].Metadata["cache_sha"])), 0600)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			it("reuses the layer and still materializes the assets", func() {
+				result, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Layers).To(HaveLen(2))
+				Expect(result.Layers[0].Cache).To(BeTrue())
+				Expect(result.Layers[0].Launch).To(BeFalse())
+
+				Expect(buildProcess.ExecuteCall.CallCount).To(Equal(1))
+				Expect(environmentSetup.MaterializeCall.CallCount).To(Equal(2))
+				Expect(buffer.String()).To(ContainSubstring("Reusing cached layer"))
+			})
+
+			context("when the app uses propshaft", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    propshaft (0.9.0)\n"), 0600)).To(Succeed())
+					Expect(os.MkdirAll(filepath.Join(workingDir, "public", "assets"), os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets", ".manifest.json"), []byte(`{"application.css": "application-abc123.css"}`), 0600)).To(Succeed())
+
+					err := os.WriteFile(filepath.Join(layersDir, fmt.Sprintf("%s.toml", railsassets.LayerNameAssets)), []byte(`
+[metadata]
+	cache_sha = "some-calculator-sha"
+	[metadata.layout]
+		destination_paths = ["public/assets", "public/packs", "tmp/cache/assets"]
+		link_mode = "copy"
+		pipelines = ["propshaft"]
+			`), 0600)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				context("when the files in the manifest exist", func() {
+					it.Before(func() {
+						Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets", "application-abc123.css"), nil, 0600)).To(Succeed())
+					})
+
+					it("reuses the layer", func() {
+						_, err := build(packit.BuildContext{
+							WorkingDir: workingDir,
+							Layers:     packit.Layers{Path: layersDir},
+						})
+						Expect(err).NotTo(HaveOccurred())
+
+						Expect(buildProcess.ExecuteCall.CallCount).To(Equal(1))
+						Expect(buffer.String()).To(ContainSubstring("Reusing cached layer"))
+					})
+				})
+
+				context("when a file in the manifest is missing", func() {
+					it.Before(func() {
+						Expect(os.MkdirAll(filepath.Join(layersDir, "assets", "public-assets"), os.ModePerm)).To(Succeed())
+
+						buildProcess.ExecuteCall.Stub = func(string, string) error {
+							return os.WriteFile(filepath.Join(workingDir, "public", "assets", "application-abc123.css"), nil, 0600)
+						}
+					})
+
+					it("clears the layer and rebuilds it", func() {
+						result, err := build(packit.BuildContext{
+							WorkingDir: workingDir,
+							Layers:     packit.Layers{Path: layersDir},
+						})
+						Expect(err).NotTo(HaveOccurred())
+
+						Expect(buildProcess.ExecuteCall.CallCount).To(Equal(2))
+						Expect(result.Layers[0].Cache).To(BeTrue())
+						Expect(filepath.Join(layersDir, "assets", "public-assets")).NotTo(BeAnExistingFile())
+
+						Expect(buffer.String()).To(ContainSubstring("failed verification and must be rebuilt:"))
+						Expect(buffer.String()).To(ContainSubstring("public/assets/.manifest.json lists public/assets/application-abc123.css (application.css), which does not exist"))
+						Expect(buffer.String()).NotTo(ContainSubstring("Reusing cached layer"))
+					})
+				})
+			})
+		})
+	})
+
+	context("when assets are compiled", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    propshaft (0.9.0)\n"), 0600)).To(Succeed())
+
+			err := os.WriteFile(filepath.Join(layersDir, fmt.Sprintf("%s.toml", railsassets.LayerNameAssets)), []byte(`
+[metadata]
+	cache_sha = "some-previous-sha"
+	[metadata.summary]
+		bytes = 1024
+			`), 0600)
+			Expect(err).NotTo(HaveOccurred())
+
+			buildProcess.ExecuteCall.Stub = func(string, string) error {
+				err := os.MkdirAll(filepath.Join(workingDir, "public", "assets"), os.ModePerm)
+				if err != nil {
+					return err
+				}
+
+				err = os.WriteFile(filepath.Join(workingDir, "public", "assets", ".manifest.json"), []byte(`{"application.js": "application-abc.js"}`), 0600)
+				if err != nil {
+					return err
+				}
+
+				return os.WriteFile(filepath.Join(workingDir, "public", "assets", "application-abc.js"), []byte(strings.Repeat("a", 3072)), 0600)
+			}
+		})
+
+		it("logs and records a summary", func() {
+			result, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				Layers:     packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring("Compiled assets"))
+			Expect(buffer.String()).To(ContainSubstring("1 assets, 3.0 KiB ("))
+			Expect(buffer.String()).To(ContainSubstring("+2.0 KiB since the previous build"))
+			Expect(buffer.String()).To(ContainSubstring("application.js: 3.0 KiB ("))
+
+			Expect(result.Layers[0].Metadata["summary"]).To(HaveKeyWithValue("count", 1))
+			Expect(result.Layers[0].Metadata["summary"]).To(HaveKeyWithValue("bytes", int64(3072)))
+		})
+
+		context("when the app uses jsbundling-rails or cssbundling-rails", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    cssbundling-rails (1.4.0)\n    propshaft (0.9.0)\n"), 0600)).To(Succeed())
+
+				buildsDir := filepath.Join(workingDir, "app", "assets", "builds")
+				Expect(os.MkdirAll(buildsDir, os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(buildsDir, ".keep"), []byte(""), 0600)).To(Succeed())
+
+				compile := buildProcess.ExecuteCall.Stub
+				buildProcess.ExecuteCall.Stub = func(workingDir, platformDir string) error {
+					err := compile(workingDir, platformDir)
+					if err != nil {
+						return err
+					}
+
+					err = os.WriteFile(filepath.Join(buildsDir, "application.css"), []byte("body {}"), 0600)
+					if err != nil {
+						return err
+					}
+
+					return os.WriteFile(filepath.Join(buildsDir, "application.css.map"), []byte("{}"), 0600)
+				}
+			})
+
+			it("removes the generated output from app/assets/builds once it is verified", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filepath.Join(workingDir, "app", "assets", "builds", ".keep")).To(BeAnExistingFile())
+				Expect(filepath.Join(workingDir, "app", "assets", "builds", "application.css")).NotTo(BeAnExistingFile())
+				Expect(filepath.Join(workingDir, "app", "assets", "builds", "application.css.map")).NotTo(BeAnExistingFile())
+				Expect(buffer.String()).To(ContainSubstring("Removed 2 generated entries from app/assets/builds"))
+			})
+
+			context("when BP_RAILS_ASSETS_KEEP_BUILDS is true", func() {
+				it.Before(func() {
+					t.Setenv("BP_RAILS_ASSETS_KEEP_BUILDS", "true")
+				})
+
+				it("keeps the generated output", func() {
+					_, err := build(packit.BuildContext{
+						WorkingDir: workingDir,
+						Layers:     packit.Layers{Path: layersDir},
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(filepath.Join(workingDir, "app", "assets", "builds", "application.css")).To(BeAnExistingFile())
+				})
+			})
+
+			context("when the bundler writes nothing to app/assets/builds", func() {
+				it.Before(func() {
+					buildProcess.ExecuteCall.Stub = nil
+				})
+
+				it("fails verification", func() {
+					_, err := build(packit.BuildContext{
+						WorkingDir: workingDir,
+						Layers:     packit.Layers{Path: layersDir},
+					})
+					Expect(err).To(MatchError(ContainSubstring("app/assets/builds contains no output from jsbundling-rails or cssbundling-rails")))
+				})
+			})
+		})
+
+		context("when the assets have source maps", func() {
+			it.Before(func() {
+				compile := buildProcess.ExecuteCall.Stub
+				buildProcess.ExecuteCall.Stub = func(workingDir, platformDir string) error {
+					err := compile(workingDir, platformDir)
+					if err != nil {
+						return err
+					}
+
+					err = os.WriteFile(filepath.Join(workingDir, "public", "assets", ".manifest.json"), []byte(`{"application.js": "application-abc.js", "application.js.map": "application-abc.js.map"}`), 0600)
+					if err != nil {
+						return err
+					}
+
+					err = os.WriteFile(filepath.Join(workingDir, "public", "assets", "application-abc.js.map"), []byte(`{"version":3}`), 0600)
+					if err != nil {
+						return err
+					}
+
+					return os.WriteFile(filepath.Join(workingDir, "public", "assets", "application-abc.js"), []byte("console.log(1);\n//# sourceMappingURL=application-abc.js.map\n"), 0600)
+				}
+			})
+
+			it("keeps them by default", func() {
+				result, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Layers).To(HaveLen(1))
+
+				Expect(filepath.Join(workingDir, "public", "assets", "application-abc.js.map")).To(BeARegularFile())
+				Expect(buffer.String()).NotTo(ContainSubstring("Removing source maps"))
+			})
+
+			context("when BP_RAILS_ASSETS_SOURCE_MAPS=strip", func() {
+				it.Before(func() {
+					t.Setenv("BP_RAILS_ASSETS_SOURCE_MAPS", "strip")
+				})
+
+				it("removes them", func() {
+					result, err := build(packit.BuildContext{
+						WorkingDir: workingDir,
+						Layers:     packit.Layers{Path: layersDir},
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(result.Layers).To(HaveLen(1))
+
+					Expect(filepath.Join(workingDir, "public", "assets", "application-abc.js.map")).NotTo(BeAnExistingFile())
+					Expect(os.ReadFile(filepath.Join(workingDir, "public", "assets", "application-abc.js"))).To(Equal([]byte("console.log(1);\n")))
+
+					Expect(buffer.String()).To(ContainSubstring("Removing source maps"))
+					Expect(buffer.String()).To(ContainSubstring("Removed 1 source map(s)"))
+					Expect(buffer.String()).To(ContainSubstring("Removed the sourceMappingURL comments from 1 file(s)"))
+				})
+			})
+
+			context("when BP_RAILS_ASSETS_SOURCE_MAPS=separate", func() {
+				it.Before(func() {
+					t.Setenv("BP_RAILS_ASSETS_SOURCE_MAPS", "separate")
+				})
+
+				it("moves them to the source-maps layer", func() {
+					result, err := build(packit.BuildContext{
+						WorkingDir: workingDir,
+						Layers:     packit.Layers{Path: layersDir},
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(result.Layers).To(HaveLen(2))
+
+					sourceMapsLayer := result.Layers[1]
+					Expect(sourceMapsLayer.Name).To(Equal("source-maps"))
+					Expect(sourceMapsLayer.Build).To(BeTrue())
+					Expect(sourceMapsLayer.Cache).To(BeTrue())
+					Expect(sourceMapsLayer.Launch).To(BeFalse())
+					Expect(sourceMapsLayer.BuildEnv).To(Equal(packit.Environment{
+						"RAILS_ASSETS_SOURCE_MAPS_DIR.default": sourceMapsLayer.Path,
+					}))
+					Expect(sourceMapsLayer.Metadata).To(Equal(map[string]interface{}{
+						"cache_sha": result.Layers[0].Metadata["cache_sha"],
+					}))
+
+					Expect(filepath.Join(workingDir, "public", "assets", "application-abc.js.map")).NotTo(BeAnExistingFile())
+					Expect(filepath.Join(sourceMapsLayer.Path, "public", "assets", "application-abc.js.map")).To(BeARegularFile())
+
+					Expect(buffer.String()).To(ContainSubstring("Moved 1 source map(s) to " + sourceMapsLayer.Path))
+				})
+
+				context("when BP_RAILS_ASSETS_SOURCE_MAPS_PATH is set", func() {
+					var exportDir string
+
+					it.Before(func() {
+						var err error
+						exportDir, err = os.MkdirTemp("", "export")
+						Expect(err).NotTo(HaveOccurred())
+
+						t.Setenv("BP_RAILS_ASSETS_SOURCE_MAPS_PATH", exportDir)
+					})
+
+					it.After(func() {
+						Expect(os.RemoveAll(exportDir)).To(Succeed())
+					})
+
+					it("also copies them there", func() {
+						_, err := build(packit.BuildContext{
+							WorkingDir: workingDir,
+							Layers:     packit.Layers{Path: layersDir},
+						})
+						Expect(err).NotTo(HaveOccurred())
+
+						Expect(filepath.Join(exportDir, "public", "assets", "application-abc.js.map")).To(BeARegularFile())
+						Expect(buffer.String()).To(ContainSubstring("Exporting source maps to " + exportDir))
+					})
+				})
+
+				context("when the checksum matches the cached layer", func() {
+					var sum string
+
+					it.Before(func() {
+						result, err := build(packit.BuildContext{
+							WorkingDir: workingDir,
+							Layers:     packit.Layers{Path: layersDir},
+						})
+						Expect(err).NotTo(HaveOccurred())
+
+						sum = result.Layers[0].Metadata["cache_sha"].(string)
+						err = os.WriteFile(filepath.Join(layersDir, fmt.Sprintf("%s.toml", railsassets.LayerNameAssets)), []byte(fmt.Sprintf(`
+[metadata]
+	cache_sha = %q
+	[metadata.layout]
+		destination_paths = ["public/assets", "public/packs", "tmp/cache/assets"]
+		link_mode = "symlink"
+		pipelines = ["propshaft"]
+			`, sum)), 0600)
+						Expect(err).NotTo(HaveOccurred())
+					})
+
+					it("rebuilds when the source maps are not cached", func() {
+						_, err := build(packit.BuildContext{
+							WorkingDir: workingDir,
+							Layers:     packit.Layers{Path: layersDir},
+						})
+						Expect(err).NotTo(HaveOccurred())
+
+						Expect(buildProcess.ExecuteCall.CallCount).To(Equal(2))
+						Expect(buffer.String()).To(ContainSubstring("Cached source maps are missing"))
+					})
+
+					context("when the source maps are cached", func() {
+						it.Before(func() {
+							err := os.WriteFile(filepath.Join(layersDir, fmt.Sprintf("%s.toml", railsassets.LayerNameSourceMaps)), []byte(fmt.Sprintf(`
+[metadata]
+	cache_sha = %q
+			`, sum)), 0600)
+							Expect(err).NotTo(HaveOccurred())
+						})
+
+						it("reuses both layers", func() {
+							result, err := build(packit.BuildContext{
+								WorkingDir: workingDir,
+								Layers:     packit.Layers{Path: layersDir},
+							})
+							Expect(err).NotTo(HaveOccurred())
+							Expect(result.Layers).To(HaveLen(2))
+							Expect(result.Layers[1].Name).To(Equal("source-maps"))
+
+							Expect(buildProcess.ExecuteCall.CallCount).To(Equal(1))
+							Expect(buffer.String()).To(ContainSubstring("Reusing cached layer"))
+						})
+					})
+				})
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_EXPORT is set", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_EXPORT", "directory")
+			})
+
+			it("exports the assets to the assets-export layer", func() {
+				result, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Layers).To(HaveLen(2))
+
+				exportLayer := result.Layers[1]
+				Expect(exportLayer.Name).To(Equal("assets-export"))
+				Expect(exportLayer.Build).To(BeTrue())
+				Expect(exportLayer.Cache).To(BeTrue())
+				Expect(exportLayer.Launch).To(BeFalse())
+				Expect(exportLayer.BuildEnv).To(Equal(packit.Environment{
+					"RAILS_ASSETS_EXPORT_DIR.default": exportLayer.Path,
+				}))
+				Expect(exportLayer.Metadata).To(Equal(map[string]interface{}{
+					"cache_sha": result.Layers[0].Metadata["cache_sha"],
+					"format":    "directory",
+				}))
+
+				Expect(filepath.Join(exportLayer.Path, "index.json")).To(BeARegularFile())
+				Expect(filepath.Join(exportLayer.Path, "public", "assets", "application-abc.js")).To(BeARegularFile())
+
+				Expect(buffer.String()).To(ContainSubstring("Exporting assets"))
+				Expect(buffer.String()).To(ContainSubstring("Exported 1 file(s) to " + exportLayer.Path))
+			})
+
+			context("when BP_RAILS_ASSETS_EXPORT_PATH is set", func() {
+				var exportDir string
+
+				it.Before(func() {
+					var err error
+					exportDir, err = os.MkdirTemp("", "export")
+					Expect(err).NotTo(HaveOccurred())
+
+					t.Setenv("BP_RAILS_ASSETS_EXPORT", "tarball")
+					t.Setenv("BP_RAILS_ASSETS_EXPORT_PATH", exportDir)
+				})
+
+				it.After(func() {
+					Expect(os.RemoveAll(exportDir)).To(Succeed())
+				})
+
+				it("also copies the export there", func() {
+					_, err := build(packit.BuildContext{
+						WorkingDir: workingDir,
+						Layers:     packit.Layers{Path: layersDir},
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(filepath.Join(exportDir, "assets.tar.gz")).To(BeARegularFile())
+					Expect(buffer.String()).To(ContainSubstring("Copying the asset export to " + exportDir))
+				})
+			})
+
+			context("when the checksum matches the cached layer", func() {
+				it.Before(func() {
+					result, err := build(packit.BuildContext{
+						WorkingDir: workingDir,
+						Layers:     packit.Layers{Path: layersDir},
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					err = os.WriteFile(filepath.Join(layersDir, fmt.Sprintf("%s.toml", railsassets.LayerNameAssets)), []byte(fmt.Sprintf(`
+[metadata]
+	cache_sha = %q
+	[metadata.layout]
+		destination_paths = ["public/assets", "public/packs", "tmp/cache/assets"]
+		link_mode = "symlink"
+		pipelines = ["propshaft"]
+			`, result.Layers[0].Metadata["cache_sha"])), 0600)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				it("rebuilds when the export is not cached", func() {
+					_, err := build(packit.BuildContext{
+						WorkingDir: workingDir,
+						Layers:     packit.Layers{Path: layersDir},
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(buildProcess.ExecuteCall.CallCount).To(Equal(2))
+					Expect(buffer.String()).To(ContainSubstring("Cached asset export is missing"))
+				})
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_ASSET_HOST is set", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_ASSET_HOST", "https://cdn.example.com")
+			})
+
+			it("sets ASSET_HOST in the launch environment", func() {
+				result, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(result.Layers[0].LaunchEnv).To(HaveKeyWithValue("ASSET_HOST.default", "https://cdn.example.com"))
+				Expect(result.Layers[0].Metadata["cache_sha"]).NotTo(Equal("some-calculator-sha"))
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_OPTIMIZE_IMAGES is set", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_OPTIMIZE_IMAGES", "true")
+			})
+
+			it("optimizes the compiled images", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).To(ContainSubstring("Optimizing images"))
+				Expect(buffer.String()).To(ContainSubstring("Optimized 0 image(s), saving 0 B"))
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_PRECOMPRESS is set", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_PRECOMPRESS", "gzip,brotli")
+			})
+
+			it("writes precompressed variants and measures the gzip variant", func() {
+				result, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filepath.Join(workingDir, "public", "assets", "application-abc.js.gz")).To(BeARegularFile())
+				Expect(filepath.Join(workingDir, "public", "assets", "application-abc.js.br")).To(BeARegularFile())
+
+				Expect(buffer.String()).To(ContainSubstring("Precompressing assets"))
+				Expect(buffer.String()).To(ContainSubstring("Wrote 1 gzip file(s)"))
+				Expect(buffer.String()).To(ContainSubstring("Wrote 1 brotli file(s)"))
+
+				info, err := os.Stat(filepath.Join(workingDir, "public", "assets", "application-abc.js.gz"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Layers[0].Metadata["summary"]).To(HaveKeyWithValue("compressed_bytes", info.Size()))
+			})
+		})
+
+		context("when an asset exceeds its size budget", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_BUDGETS", "application-*.js <= 2KiB")
+			})
+
+			it("fails the build with a table of the assets over budget", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError(ContainSubstring("the compiled assets exceed their size budgets:")))
+				Expect(err).To(MatchError(ContainSubstring("application-*.js  application.js  3.0 KiB  2.0 KiB  +1.0 KiB (50%)")))
+				Expect(err).To(MatchError(ContainSubstring("set $BP_RAILS_ASSETS_BUDGETS_MODE=warn to continue anyway")))
+			})
+
+			context("when BP_RAILS_ASSETS_BUDGETS_MODE=warn", func() {
+				it.Before(func() {
+					t.Setenv("BP_RAILS_ASSETS_BUDGETS_MODE", "warn")
+				})
+
+				it("logs the assets over budget and continues", func() {
+					result, err := build(packit.BuildContext{
+						WorkingDir: workingDir,
+						Layers:     packit.Layers{Path: layersDir},
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(result.Layers).To(HaveLen(1))
+
+					Expect(buffer.String()).To(ContainSubstring("Warning: the compiled assets exceed their size budgets:"))
+					Expect(buffer.String()).To(ContainSubstring("application-*.js  application.js  3.0 KiB  2.0 KiB  +1.0 KiB (50%)"))
+				})
+			})
+
+			context("when the cached layer is reused", func() {
+				it.Before(func() {
+					Expect(buildProcess.ExecuteCall.Stub(workingDir, "")).To(Succeed())
+
+					err := os.WriteFile(filepath.Join(layersDir, fmt.Sprintf("%s.toml", railsassets.LayerNameAssets)), []byte(`
+[metadata]
+	cache_sha = "some-calculator-sha"
+	[metadata.layout]
+		destination_paths = ["public/assets", "public/packs", "tmp/cache/assets"]
+		link_mode = "symlink"
+		pipelines = ["propshaft"]
+			`), 0600)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				it("checks the cached assets against the budgets", func() {
+					_, err := build(packit.BuildContext{
+						WorkingDir: workingDir,
+						Layers:     packit.Layers{Path: layersDir},
+					})
+					Expect(err).To(MatchError(ContainSubstring("application-*.js  application.js  3.0 KiB  2.0 KiB  +1.0 KiB (50%)")))
+
+					Expect(buildProcess.ExecuteCall.CallCount).To(Equal(0))
+				})
+			})
+		})
+
+		context("when the assets are within their size budgets", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_BUDGETS", "total *.js <= 300KB")
+			})
+
+			it("continues", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(buffer.String()).NotTo(ContainSubstring("size budgets"))
+			})
+		})
+	})
+
+	context("when the compiled assets fail verification", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    propshaft (0.9.0)\n"), 0600)).To(Succeed())
+		})
+
+		it("fails the build with the list of problems", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				Layers:     packit.Layers{Path: layersDir},
+			})
+			Expect(err).To(MatchError("the compiled assets failed verification:\n  no Sprockets or Propshaft manifest exists in public/assets\nset $BP_RAILS_ASSETS_VERIFY=warn to continue anyway"))
+		})
+
+		context("when BP_RAILS_ASSETS_VERIFY=warn", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_VERIFY", "warn")
+			})
+
+			it("logs the problems and continues", func() {
+				result, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Layers).To(HaveLen(1))
+
+				Expect(buffer.String()).To(ContainSubstring("Warning: the compiled assets failed verification:"))
+				Expect(buffer.String()).To(ContainSubstring("no Sprockets or Propshaft manifest exists in public/assets"))
+			})
+		})
+
+		context("when the output holds a manifest from an earlier build", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(workingDir, "public", "assets"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets", ".manifest.json"), []byte(`{"application.js": "application-abc.js"}`), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets", "application-abc.js"), []byte("old"), 0600)).To(Succeed())
+
+				earlier := time.Now().Add(-time.Hour)
+				Expect(os.Chtimes(filepath.Join(workingDir, "public", "assets", ".manifest.json"), earlier, earlier)).To(Succeed())
+			})
+
+			it("does not accept it as the output of the precompile", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError(ContainSubstring("public/assets/.manifest.json was not written by this precompile")))
+			})
+		})
+	})
+
+	context("failure cases", func() {
+		context("when BP_RAILS_ASSETS_BUDGETS is invalid", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_BUDGETS", "application.js < 300KB")
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{WorkingDir: workingDir})
+				Expect(err).To(MatchError(ContainSubstring(`invalid budget "application.js < 300KB" in $BP_RAILS_ASSETS_BUDGETS`)))
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_SOURCE_MAPS is invalid", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_SOURCE_MAPS", "hide")
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{WorkingDir: workingDir})
+				Expect(err).To(MatchError(ContainSubstring(`invalid BP_RAILS_ASSETS_SOURCE_MAPS "hide"`)))
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_SOURCE_MAPS_PATH is relative", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_SOURCE_MAPS_PATH", "maps")
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{WorkingDir: workingDir})
+				Expect(err).To(MatchError(`invalid BP_RAILS_ASSETS_SOURCE_MAPS_PATH "maps": must be an absolute path`))
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_EXPORT is invalid", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_EXPORT", "zip")
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{WorkingDir: workingDir})
+				Expect(err).To(MatchError(ContainSubstring(`invalid BP_RAILS_ASSETS_EXPORT "zip"`)))
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_EXPORT_PATH is relative", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_EXPORT_PATH", "export")
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{WorkingDir: workingDir})
+				Expect(err).To(MatchError(`invalid BP_RAILS_ASSETS_EXPORT_PATH "export": must be an absolute path`))
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_OPTIMIZE_IMAGES is invalid", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_OPTIMIZE_IMAGES", "sometimes")
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{WorkingDir: workingDir})
+				Expect(err).To(MatchError(ContainSubstring("failed to parse BP_RAILS_ASSETS_OPTIMIZE_IMAGES")))
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_PRECOMPRESS is invalid", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_PRECOMPRESS", "zstd")
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{WorkingDir: workingDir})
+				Expect(err).To(MatchError(ContainSubstring(`invalid BP_RAILS_ASSETS_PRECOMPRESS "zstd"`)))
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_BUDGETS_MODE is invalid", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_BUDGETS_MODE", "never")
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{WorkingDir: workingDir})
+				Expect(err).To(MatchError(`invalid BP_RAILS_ASSETS_BUDGETS_MODE "never": must be "fail" or "warn"`))
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_VERIFY is invalid", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_VERIFY", "never")
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{})
+				Expect(err).To(MatchError(`invalid BP_RAILS_ASSETS_VERIFY "never": must be "fail" or "warn"`))
+			})
+		})
+
+		context("when the link mode is invalid", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_LINK_MODE", "hardlink")
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{})
+				Expect(err).To(MatchError(ContainSubstring(`invalid BP_RAILS_ASSETS_LINK_MODE "hardlink"`)))
+			})
+		})
+
+		context("when materializing the assets fails", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_LINK_MODE", "copy")
+				environmentSetup.MaterializeCall.Returns.Error = errors.New("some-error")
+			})
+
+			it("returns the error", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					Layers:     packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError("some-error"))
+			})
+		})
+
 		context("when environment setup fails", func() {
 			it.Before(func() {
 				environmentSetup.ResetLocalCall.Returns.Error = errors.New("some-error")
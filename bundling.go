@@ -0,0 +1,74 @@
+package railsassets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// usesBundling returns true when the application builds its JavaScript or CSS
+// with jsbundling-rails or cssbundling-rails. These gems write their output
+// to app/assets/builds before it is digested into public/assets.
+func usesBundling(lock GemfileLock) bool {
+	return lock.Has("jsbundling-rails") || lock.Has("cssbundling-rails")
+}
+
+// excludeBuildsDirectory replaces app/assets in paths with its entries, less
+// app/assets/builds, so that generated output does not affect the checksum.
+func excludeBuildsDirectory(workingDir string, paths []string) ([]string, error) {
+	assetsDir := filepath.Join(workingDir, "app", "assets")
+
+	var result []string
+	for _, path := range paths {
+		if path != assetsDir {
+			result = append(result, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(assetsDir)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if entry.Name() != "builds" {
+				result = append(result, filepath.Join(assetsDir, entry.Name()))
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// cleanBuildsDirectory removes the generated contents of app/assets/builds,
+// keeping the directory and any .keep or .gitkeep file in it. It returns the
+// names of the removed entries.
+func cleanBuildsDirectory(workingDir string) ([]string, error) {
+	buildsDir := filepath.Join(workingDir, "app", "assets", "builds")
+
+	entries, err := os.ReadDir(buildsDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var removed []string
+	for _, entry := range entries {
+		if entry.Name() == ".keep" || entry.Name() == ".gitkeep" {
+			continue
+		}
+
+		err = os.RemoveAll(filepath.Join(buildsDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		removed = append(removed, entry.Name())
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,139 @@
+package railsassets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DestinationPath is a directory, relative to the working directory, that the
+// "rails assets:precompile" build process writes to, along with a description
+// of where the buildpack learned about it.
+type DestinationPath struct {
+	Path   string
+	Source string
+}
+
+// DiscoverDestinationPaths scans the configuration of the application for
+// directories, beyond public/assets, public/packs and tmp/cache/assets, that
+// the "rails assets:precompile" build process writes to. It reads:
+//   - config.assets.prefix from config/application.rb,
+//     config/environments/production.rb and config/initializers/*.rb
+//   - public_output_path and cache_path from config/shakapacker.yml or
+//     config/webpacker.yml
+//   - publicOutputDir from config/vite.json
+//
+// It returns nothing when $BP_RAILS_ASSETS_SKIP_DESTINATION_DISCOVERY is true,
+// leaving the destination paths to the buildpack defaults and
+// $BP_RAILS_ASSETS_EXTRA_DESTINATION_PATHS.
+func DiscoverDestinationPaths(workingDir string) ([]DestinationPath, error) {
+	skip, err := parseBoolEnv("BP_RAILS_ASSETS_SKIP_DESTINATION_DISCOVERY")
+	if err != nil {
+		return nil, err
+	}
+
+	if skip {
+		return nil, nil
+	}
+
+	var paths []DestinationPath
+
+	prefix, err := discoverAssetsPrefix(workingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if prefix.Path != "" {
+		paths = append(paths, prefix)
+	}
+
+	lock, err := NewGemfileLockParser().Parse(filepath.Join(workingDir, "Gemfile.lock"))
+	if err != nil {
+		return nil, err
+	}
+
+	webpacker, ok, err := ParseWebpackerConfig(workingDir, lock)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		paths = append(paths,
+			DestinationPath{Path: webpacker.PublicOutputPath, Source: fmt.Sprintf("public_output_path in %s", webpacker.ConfigPath)},
+			DestinationPath{Path: webpacker.CachePath, Source: fmt.Sprintf("cache_path in %s", webpacker.ConfigPath)},
+		)
+	}
+
+	vite, ok, err := ParseViteConfig(workingDir, lock)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		paths = append(paths, DestinationPath{Path: vite.PublicOutputDir, Source: fmt.Sprintf("publicOutputDir in %s", vite.ConfigPath)})
+	}
+
+	return paths, nil
+}
+
+// discoverAssetsPrefix finds the last literal assignment to
+// config.assets.prefix, reading the files in the order that Rails loads them.
+// It returns an empty DestinationPath when the prefix is the default.
+func discoverAssetsPrefix(workingDir string) (DestinationPath, error) {
+	files := []string{filepath.Join("config", "application.rb")}
+
+	initializers, err := filepath.Glob(filepath.Join(workingDir, "config", "initializers", "*.rb"))
+	if err != nil {
+		return DestinationPath{}, err
+	}
+
+	files = append(files, filepath.Join("config", "environments", "production.rb"))
+	for _, initializer := range initializers {
+		rel, err := filepath.Rel(workingDir, initializer)
+		if err != nil {
+			return DestinationPath{}, err
+		}
+		files = append(files, rel)
+	}
+
+	prefixRe := regexp.MustCompile(`^\s*(?:Rails\.application\.)?config\.assets\.prefix\s*=\s*["']([^"'#{}]+)["']`)
+
+	var prefix DestinationPath
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.Join(workingDir, file))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return DestinationPath{}, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+
+		for _, line := range strings.Split(string(content), "\n") {
+			matches := prefixRe.FindStringSubmatch(line)
+			if matches == nil {
+				continue
+			}
+
+			// A prefix of "/" would mean linking the whole of public/ into the
+			// layer, so it is ignored.
+			dir := filepath.Clean(strings.TrimPrefix(matches[1], "/"))
+			if dir == "." {
+				continue
+			}
+
+			prefix = DestinationPath{
+				Path:   filepath.Join("public", dir),
+				Source: fmt.Sprintf("config.assets.prefix in %s", file),
+			}
+		}
+	}
+
+	if prefix.Path == filepath.Join("public", "assets") {
+		return DestinationPath{}, nil
+	}
+
+	return prefix, nil
+}
@@ -0,0 +1,164 @@
+package railsassets_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	railsassets "github.com/paketo-buildpacks/rails-assets"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testDestinationDiscovery(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(workingDir, "config", "environments"), os.ModePerm)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(workingDir, "config", "initializers"), os.ModePerm)).To(Succeed())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("DiscoverDestinationPaths", func() {
+		it("returns nothing for a default application", func() {
+			paths, err := railsassets.DiscoverDestinationPaths(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths).To(BeEmpty())
+		})
+
+		context("when config.assets.prefix is set", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "config", "application.rb"), []byte(`
+module SomeApp
+  class Application < Rails::Application
+    config.assets.prefix = "/static"
+  end
+end
+`), 0600)).To(Succeed())
+			})
+
+			it("discovers the prefix directory", func() {
+				paths, err := railsassets.DiscoverDestinationPaths(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(paths).To(Equal([]railsassets.DestinationPath{
+					{Path: filepath.Join("public", "static"), Source: "config.assets.prefix in " + filepath.Join("config", "application.rb")},
+				}))
+			})
+
+			context("when an initializer overrides it", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "config", "environments", "production.rb"), []byte(`
+  config.assets.prefix = '/production-assets'
+`), 0600)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "config", "initializers", "assets.rb"), []byte(`
+Rails.application.config.assets.version = "1.0"
+# config.assets.prefix = "/commented"
+config.assets.prefix = "/cdn/assets"
+`), 0600)).To(Succeed())
+				})
+
+				it("uses the assignment that Rails loads last", func() {
+					paths, err := railsassets.DiscoverDestinationPaths(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(paths).To(Equal([]railsassets.DestinationPath{
+						{Path: filepath.Join("public", "cdn", "assets"), Source: "config.assets.prefix in " + filepath.Join("config", "initializers", "assets.rb")},
+					}))
+				})
+			})
+
+			context("when an initializer sets it through Rails.application", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "config", "initializers", "assets.rb"), []byte(`
+Rails.application.config.assets.prefix = "/packed"
+`), 0600)).To(Succeed())
+				})
+
+				it("discovers the prefix directory", func() {
+					paths, err := railsassets.DiscoverDestinationPaths(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(paths).To(Equal([]railsassets.DestinationPath{
+						{Path: filepath.Join("public", "packed"), Source: "config.assets.prefix in " + filepath.Join("config", "initializers", "assets.rb")},
+					}))
+				})
+			})
+
+			context("when it is the default", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "config", "environments", "production.rb"), []byte(`config.assets.prefix = "/assets"`), 0600)).To(Succeed())
+				})
+
+				it("returns nothing", func() {
+					paths, err := railsassets.DiscoverDestinationPaths(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(paths).To(BeEmpty())
+				})
+			})
+		})
+
+		context("when the app uses shakapacker and vite ruby", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    shakapacker (7.2.0)\n    vite_ruby (3.5.0)\n"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "config", "shakapacker.yml"), []byte("production:\n  public_output_path: js\n"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "config", "vite.json"), []byte(`{"production": {"publicOutputDir": "bundles"}}`), 0600)).To(Succeed())
+			})
+
+			it("discovers their output directories", func() {
+				paths, err := railsassets.DiscoverDestinationPaths(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(paths).To(Equal([]railsassets.DestinationPath{
+					{Path: filepath.Join("public", "js"), Source: "public_output_path in " + filepath.Join("config", "shakapacker.yml")},
+					{Path: filepath.Join("tmp", "shakapacker"), Source: "cache_path in " + filepath.Join("config", "shakapacker.yml")},
+					{Path: filepath.Join("public", "bundles"), Source: "publicOutputDir in " + filepath.Join("config", "vite.json")},
+				}))
+			})
+
+			context("when discovery is skipped", func() {
+				it.Before(func() {
+					t.Setenv("BP_RAILS_ASSETS_SKIP_DESTINATION_DISCOVERY", "true")
+				})
+
+				it("returns nothing", func() {
+					paths, err := railsassets.DiscoverDestinationPaths(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(paths).To(BeEmpty())
+				})
+			})
+		})
+
+		context("failure cases", func() {
+			context("when the Gemfile.lock cannot be read", func() {
+				it.Before(func() {
+					Expect(os.Mkdir(filepath.Join(workingDir, "Gemfile.lock"), os.ModePerm)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := railsassets.DiscoverDestinationPaths(workingDir)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse Gemfile.lock")))
+				})
+			})
+
+			context("when BP_RAILS_ASSETS_SKIP_DESTINATION_DISCOVERY is not a boolean", func() {
+				it.Before(func() {
+					t.Setenv("BP_RAILS_ASSETS_SKIP_DESTINATION_DISCOVERY", "sometimes")
+				})
+
+				it("returns an error", func() {
+					_, err := railsassets.DiscoverDestinationPaths(workingDir)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse BP_RAILS_ASSETS_SKIP_DESTINATION_DISCOVERY")))
+				})
+			})
+		})
+	})
+}
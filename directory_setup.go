@@ -1,37 +1,107 @@
 package railsassets
 
 import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/fs"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
 )
 
+// LinkMode determines how the directories in the "assets" layer are made
+// available in the working directory.
+type LinkMode string
+
+const (
+	// LinkModeSymlink links each directory with an absolute symlink. This is
+	// the default.
+	LinkModeSymlink LinkMode = "symlink"
+
+	// LinkModeRelativeSymlink links each directory with a symlink that is
+	// relative to the location of the link.
+	LinkModeRelativeSymlink LinkMode = "relative-symlink"
+
+	// LinkModeCopy links each directory with an absolute symlink during the
+	// build and replaces the link with a copy of the directory at the end of
+	// the build. The "assets" layer is then only used as a cache.
+	LinkModeCopy LinkMode = "copy"
+)
+
+// ParseLinkMode reads the link mode from $BP_RAILS_ASSETS_LINK_MODE.
+func ParseLinkMode() (LinkMode, error) {
+	switch mode := LinkMode(os.Getenv("BP_RAILS_ASSETS_LINK_MODE")); mode {
+	case "":
+		return LinkModeSymlink, nil
+	case LinkModeSymlink, LinkModeRelativeSymlink, LinkModeCopy:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid BP_RAILS_ASSETS_LINK_MODE %q: must be one of %q, %q or %q", mode, LinkModeSymlink, LinkModeRelativeSymlink, LinkModeCopy)
+	}
+}
+
+// layerEntries are the entries of a layer directory that the buildpack
+// lifecycle manages, and that ResetLayer must leave in place.
+var layerEntries = map[string]bool{
+	"env":        true,
+	"env.build":  true,
+	"env.launch": true,
+	"exec.d":     true,
+	"profile.d":  true,
+}
+
 // DirectorySetup performs the operations necessary to setup a valid working
 // directory and link it to the layers created by the buildpack.
-type DirectorySetup struct{}
+type DirectorySetup struct {
+	logger scribe.Emitter
+}
 
 // NewDirectorySetup initializes a DirectorySetup instance.
-func NewDirectorySetup() DirectorySetup {
-	return DirectorySetup{}
+func NewDirectorySetup(logger scribe.Emitter) DirectorySetup {
+	return DirectorySetup{
+		logger: logger,
+	}
 }
 
-// ResetLocal deletes public/assets, public/packs, tmp/cache/assets,
-// and all custom assets directories. These directories will be replaced
-// by links to directories internal to the "assets" layer that is created
-// by this buildpack.
+// ResetLocal deletes public/assets, public/packs, tmp/cache/assets, the
+// directories found by DiscoverDestinationPaths, and all custom assets
+// directories. These directories will be replaced by links to directories
+// internal to the "assets" layer that is created by this buildpack. Unless
+// $BP_RAILS_ASSETS_PRESERVE_COMMITTED is set, a warning lists any files that
+// were committed to these directories before they are deleted.
 //
 // Additionally, ResetLocal ensures that the working directory at least
 // contains a public and tmp/cache directory so that these links have a
 // location to be placed into.
-func (DirectorySetup) ResetLocal(workingDir string) error {
-	paths := []string{
-		filepath.Join("public", "assets"),
-		filepath.Join("public", "packs"),
-		filepath.Join("tmp", "cache", "assets"),
+func (s DirectorySetup) ResetLocal(workingDir string) error {
+	paths, err := assetsDestinationPaths(workingDir)
+	if err != nil {
+		return err
+	}
+
+	preserve, err := parseBoolEnv("BP_RAILS_ASSETS_PRESERVE_COMMITTED")
+	if err != nil {
+		return err
 	}
-	paths = append(paths, customAssetsPrecompilePaths()...)
 
 	for _, path := range paths {
+		if !preserve {
+			files, err := committedFiles(workingDir, path)
+			if err != nil {
+				return err
+			}
+
+			if len(files) > 0 {
+				s.logger.Process("Warning: removing %d committed file(s) from %s", len(files), path)
+				s.listFiles(files)
+				s.logger.Subprocess("Set $BP_RAILS_ASSETS_PRESERVE_COMMITTED=true to keep them")
+				s.logger.Break()
+			}
+		}
+
 		err := os.RemoveAll(filepath.Join(workingDir, path))
 		if err != nil {
 			return err
@@ -48,26 +118,121 @@ func (DirectorySetup) ResetLocal(workingDir string) error {
 	return nil
 }
 
-// ResetLayer ensures that the "assets" layer contains public-assets,
-// public-packs, and tmp-cache-assets and the custom assets directories defined by the user.
-// These directories will hold the results of running the "rails assets:precompile" build process.
-func (DirectorySetup) ResetLayer(layerPath string) error {
-	err := os.MkdirAll(filepath.Join(layerPath, "public-assets"), os.ModePerm)
+// PreserveCommitted copies the files that were committed to the destination
+// paths into stagingDir, so that they can be restored into the "assets" layer
+// by RestoreCommitted after ResetLocal has deleted them.
+func (s DirectorySetup) PreserveCommitted(workingDir, stagingDir string) error {
+	paths, err := assetsDestinationPaths(workingDir)
 	if err != nil {
 		return err
 	}
 
-	err = os.MkdirAll(filepath.Join(layerPath, "public-packs"), os.ModePerm)
+	for _, path := range paths {
+		files, err := committedFiles(workingDir, path)
+		if err != nil {
+			return err
+		}
+
+		if len(files) == 0 {
+			continue
+		}
+
+		if files[0] == path {
+			return fmt.Errorf("failed to preserve committed files in %s: it is a file, not a directory", path)
+		}
+
+		s.logger.Process("Preserving %d committed file(s) from %s", len(files), path)
+		s.listFiles(files)
+		s.logger.Break()
+
+		err = fs.Copy(filepath.Join(workingDir, path), filepath.Join(stagingDir, slugifyPath(path)))
+		if err != nil {
+			return fmt.Errorf("failed to preserve committed files in %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// RestoreCommitted copies the files preserved by PreserveCommitted into the
+// matching directories of the "assets" layer, replacing any file with the
+// same name.
+func (DirectorySetup) RestoreCommitted(stagingDir, layerPath string) error {
+	dirs, err := os.ReadDir(stagingDir)
 	if err != nil {
 		return err
 	}
 
-	err = os.MkdirAll(filepath.Join(layerPath, "tmp-cache-assets"), os.ModePerm)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(filepath.Join(stagingDir, dir.Name()))
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			destination := filepath.Join(layerPath, dir.Name(), entry.Name())
+
+			err = os.RemoveAll(destination)
+			if err != nil {
+				return err
+			}
+
+			err = fs.Copy(filepath.Join(stagingDir, dir.Name(), entry.Name()), destination)
+			if err != nil {
+				return fmt.Errorf("failed to restore committed files: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ResetLayer ensures that the "assets" layer contains empty public-assets,
+// public-packs, and tmp-cache-assets directories, the directories found by
+// DiscoverDestinationPaths, and the custom assets directories defined by the
+// user. These directories will hold the results of
+// running the "rails assets:precompile" build process. Directories for
+// destination paths that are no longer configured are removed, and the output
+// of the previous build is removed from the others. Only the caches under tmp
+// are kept.
+func (DirectorySetup) ResetLayer(layerPath, workingDir string) error {
+	paths, err := assetsDestinationPaths(workingDir)
 	if err != nil {
 		return err
 	}
 
-	for _, path := range customAssetsPrecompilePaths() {
+	configured := map[string]bool{}
+	caches := map[string]bool{}
+	for _, path := range paths {
+		configured[slugifyPath(path)] = true
+		caches[slugifyPath(path)] = strings.HasPrefix(path, "tmp"+string(filepath.Separator))
+	}
+
+	entries, err := os.ReadDir(layerPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	for _, entry := range entries {
+		if caches[entry.Name()] || layerEntries[entry.Name()] {
+			continue
+		}
+
+		if configured[entry.Name()] {
+			err = emptyDirectory(filepath.Join(layerPath, entry.Name()))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = os.RemoveAll(filepath.Join(layerPath, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, path := range paths {
 		err := os.MkdirAll(filepath.Join(layerPath, slugifyPath(path)), os.ModePerm)
 		if err != nil {
 			return err
@@ -77,45 +242,332 @@ func (DirectorySetup) ResetLayer(layerPath string) error {
 	return nil
 }
 
+// emptyDirectory removes the contents of a directory, keeping the directory.
+func emptyDirectory(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		err = os.RemoveAll(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Link creates symlinks between the working directory and the directories in
 // the "assets" layer that contain the results of the "rails assets:precompile"
 // build process. This makes those contents appear as if they are part of the
 // application source code while still being located in a layer that can be
-// cached and reused on subsequent builds.
-func (DirectorySetup) Link(layerPath, workingDir string) error {
-	err := os.Symlink(filepath.Join(layerPath, "public-assets"), filepath.Join(workingDir, "public", "assets"))
+// cached and reused on subsequent builds. With the "relative-symlink" link
+// mode, the symlinks are relative to their location in the working directory.
+//
+// Link can be run more than once: symlinks that already point into the layer
+// and empty directories are replaced. Any other existing file, directory or
+// symlink is left alone and reported as an error.
+func (s DirectorySetup) Link(layerPath, workingDir string) error {
+	mode, err := ParseLinkMode()
 	if err != nil {
 		return err
 	}
 
-	err = os.Symlink(filepath.Join(layerPath, "public-packs"), filepath.Join(workingDir, "public", "packs"))
+	paths, err := assetsDestinationPaths(workingDir)
 	if err != nil {
 		return err
 	}
 
-	err = os.Symlink(filepath.Join(layerPath, "tmp-cache-assets"), filepath.Join(workingDir, "tmp", "cache", "assets"))
+	for _, path := range paths {
+		target := filepath.Join(layerPath, slugifyPath(path))
+		link := filepath.Join(workingDir, path)
+
+		err := clearLink(link, layerPath)
+		if err != nil {
+			return fmt.Errorf("failed to link %s: %w", path, err)
+		}
+
+		err = os.MkdirAll(filepath.Dir(link), os.ModePerm)
+		if err != nil {
+			return err
+		}
+
+		if mode == LinkModeRelativeSymlink {
+			target, err = filepath.Rel(filepath.Dir(link), target)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = os.Symlink(target, link)
+		if err != nil {
+			return err
+		}
+
+		s.logger.Debug.Subprocess("%s -> %s", path, target)
+	}
+
+	return nil
+}
+
+// Materialize replaces the symlinks created by Link with copies of the
+// directories they point to when the link mode is "copy". In every other
+// link mode it does nothing.
+func (DirectorySetup) Materialize(layerPath, workingDir string) error {
+	mode, err := ParseLinkMode()
 	if err != nil {
 		return err
 	}
 
-	for _, path := range customAssetsPrecompilePaths() {
-		err := os.Symlink(filepath.Join(layerPath, slugifyPath(path)), filepath.Join(workingDir, path))
+	if mode != LinkModeCopy {
+		return nil
+	}
+
+	paths, err := assetsDestinationPaths(workingDir)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		link := filepath.Join(workingDir, path)
+
+		info, err := os.Lstat(link)
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		err = os.Remove(link)
 		if err != nil {
 			return err
 		}
+
+		err = fs.Copy(filepath.Join(layerPath, slugifyPath(path)), link)
+		if err != nil {
+			return fmt.Errorf("failed to copy %s into the working directory: %w", path, err)
+		}
 	}
 
 	return nil
 }
 
-func customAssetsPrecompilePaths() []string {
-	assetsPaths := []string{}
+// listFiles logs up to ten of the given files.
+func (s DirectorySetup) listFiles(files []string) {
+	for i, file := range files {
+		if i == 10 {
+			s.logger.Subprocess("... and %d more", len(files)-i)
+			break
+		}
+		s.logger.Subprocess(file)
+	}
+}
+
+// committedFiles lists the files, relative to the working directory, that
+// exist in a destination path before the build, ignoring the .keep and
+// .gitkeep placeholders. A destination path that is a symlink, such as one
+// left by an earlier build, has no committed files.
+func committedFiles(workingDir, path string) ([]string, error) {
+	info, err := os.Lstat(filepath.Join(workingDir, path))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil, nil
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(filepath.Join(workingDir, path), func(file string, entry iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() || entry.Name() == ".keep" || entry.Name() == ".gitkeep" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(workingDir, file)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// clearLink removes whatever is at the location of a link so that the link
+// can be created, as long as doing so does not lose any content. Symlinks
+// that point into the layer and empty directories can be removed.
+func clearLink(link, layerPath string) error {
+	info, err := os.Lstat(link)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(link)
+		if err != nil {
+			return err
+		}
+
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(link), target)
+		}
+
+		if target != layerPath && !strings.HasPrefix(target, layerPath+string(filepath.Separator)) {
+			return fmt.Errorf("it is a symlink to %s, which is outside of the assets layer; remove it or choose another destination path", target)
+		}
+
+	case info.IsDir():
+		entries, err := os.ReadDir(link)
+		if err != nil {
+			return err
+		}
+
+		if len(entries) > 0 {
+			return errors.New("it is a directory that is not empty; refusing to replace it with a link to the assets layer")
+		}
+
+	default:
+		return errors.New("it is a file; refusing to replace it with a link to the assets layer")
+	}
+
+	return os.Remove(link)
+}
+
+// defaultDestinationPaths are the destination paths that the "assets" layer
+// always holds.
+var defaultDestinationPaths = []string{
+	filepath.Join("public", "assets"),
+	filepath.Join("public", "packs"),
+	filepath.Join("tmp", "cache", "assets"),
+}
+
+// assetsDestinationPaths returns the paths, relative to the working
+// directory, that the "rails assets:precompile" build process writes to. It
+// returns an error if any of them is absolute, escapes the working directory,
+// is listed more than once in $BP_RAILS_ASSETS_EXTRA_DESTINATION_PATHS, or is
+// nested inside another destination path.
+func assetsDestinationPaths(workingDir string) ([]string, error) {
+	var destinations []DestinationPath
+	for _, path := range defaultDestinationPaths {
+		destinations = append(destinations, DestinationPath{Path: path, Source: "the buildpack defaults"})
+	}
+
+	discovered, err := DiscoverDestinationPaths(workingDir)
+	if err != nil {
+		return nil, err
+	}
+	destinations = append(destinations, discovered...)
+
+	custom, err := customAssetsPrecompilePaths()
+	if err != nil {
+		return nil, err
+	}
+	destinations = append(destinations, custom...)
+
+	var unique []DestinationPath
+	seen := map[string]bool{}
+	for _, destination := range destinations {
+		err := validateDestinationPath(destination)
+		if err != nil {
+			return nil, err
+		}
+
+		if !seen[destination.Path] {
+			seen[destination.Path] = true
+			unique = append(unique, destination)
+		}
+	}
+
+	var paths []string
+	for _, destination := range unique {
+		for _, other := range unique {
+			if strings.HasPrefix(destination.Path, other.Path+string(filepath.Separator)) {
+				return nil, fmt.Errorf("invalid destination path %q (from %s): it is nested inside %q (from %s)", destination.Path, destination.Source, other.Path, other.Source)
+			}
+		}
+
+		paths = append(paths, destination.Path)
+	}
+
+	return paths, nil
+}
+
+func customAssetsPrecompilePaths() ([]DestinationPath, error) {
+	var assetsPaths []DestinationPath
+	seen := map[string]bool{}
 	for _, customPath := range filepath.SplitList(os.Getenv("BP_RAILS_ASSETS_EXTRA_DESTINATION_PATHS")) {
-		assetsPaths = append(assetsPaths, filepath.Clean(customPath))
+		if customPath == "" {
+			continue
+		}
+
+		path := filepath.Clean(customPath)
+		if seen[path] {
+			return nil, fmt.Errorf("invalid destination path %q (from $BP_RAILS_ASSETS_EXTRA_DESTINATION_PATHS): it is listed more than once", customPath)
+		}
+		seen[path] = true
+
+		assetsPaths = append(assetsPaths, DestinationPath{Path: path, Source: "$BP_RAILS_ASSETS_EXTRA_DESTINATION_PATHS"})
+	}
+	return assetsPaths, nil
+}
+
+// validateDestinationPath ensures that a destination path names a directory
+// inside the working directory.
+func validateDestinationPath(destination DestinationPath) error {
+	path := destination.Path
+
+	switch {
+	case filepath.IsAbs(path):
+		return fmt.Errorf("invalid destination path %q (from %s): it must be relative to the application directory", path, destination.Source)
+	case path == "." || path == "":
+		return fmt.Errorf("invalid destination path %q (from %s): it must not be the application directory itself", path, destination.Source)
+	case path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)):
+		return fmt.Errorf("invalid destination path %q (from %s): it must not be outside of the application directory", path, destination.Source)
 	}
-	return assetsPaths
+
+	return nil
 }
 
+// slugifyPath names the directory in the "assets" layer that holds the
+// contents of a destination path. Path separators become "-", and existing
+// "-" and "_" characters are escaped with "_" so that no two paths share a
+// directory.
 func slugifyPath(path string) string {
-	return strings.ReplaceAll(path, string(filepath.Separator), "-")
+	var slug strings.Builder
+	for _, r := range path {
+		switch r {
+		case filepath.Separator:
+			slug.WriteRune('-')
+		case '-', '_':
+			slug.WriteRune('_')
+			slug.WriteRune(r)
+		default:
+			slug.WriteRune(r)
+		}
+	}
+	return slug.String()
 }
@@ -1,11 +1,14 @@
 package railsassets_test
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/paketo-buildpacks/packit/v2/scribe"
 	railsassets "github.com/paketo-buildpacks/rails-assets"
 	"github.com/sclevine/spec"
 
@@ -16,6 +19,7 @@ func testDirectorySetup(t *testing.T, context spec.G, it spec.S) {
 	var (
 		Expect = NewWithT(t).Expect
 
+		buffer                      *bytes.Buffer
 		setup                       railsassets.EnvironmentSetup
 		layerPath                   string
 		workingDir                  string
@@ -30,7 +34,8 @@ func testDirectorySetup(t *testing.T, context spec.G, it spec.S) {
 		workingDir, err = os.MkdirTemp("", "working-dir")
 		Expect(err).NotTo(HaveOccurred())
 
-		setup = railsassets.NewDirectorySetup()
+		buffer = bytes.NewBuffer(nil)
+		setup = railsassets.NewDirectorySetup(scribe.NewEmitter(buffer).WithLevel("DEBUG"))
 
 		customPaths := []string{
 			filepath.Join("public", "some-gem"),
@@ -88,11 +93,103 @@ func testDirectorySetup(t *testing.T, context spec.G, it spec.S) {
 				Expect(filepath.Join(workingDir, "another", "assets", "path")).NotTo(BeADirectory())
 			})
 		})
+
+		context("when files were committed to a destination path", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(workingDir, "public", "assets", "widget"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets", "widget", "widget.js"), nil, 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets", ".keep"), nil, 0600)).To(Succeed())
+			})
+
+			it("warns about the files that are removed", func() {
+				err := setup.ResetLocal(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).To(ContainSubstring("Warning: removing 1 committed file(s) from public/assets"))
+				Expect(buffer.String()).To(ContainSubstring("public/assets/widget/widget.js"))
+				Expect(buffer.String()).NotTo(ContainSubstring(".keep"))
+				Expect(buffer.String()).To(ContainSubstring("Set $BP_RAILS_ASSETS_PRESERVE_COMMITTED=true to keep them"))
+				Expect(filepath.Join(workingDir, "public", "assets")).NotTo(BeAnExistingFile())
+			})
+
+			context("when committed files are preserved", func() {
+				it.Before(func() {
+					t.Setenv("BP_RAILS_ASSETS_PRESERVE_COMMITTED", "true")
+				})
+
+				it("does not warn", func() {
+					err := setup.ResetLocal(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(buffer.String()).NotTo(ContainSubstring("Warning"))
+				})
+			})
+		})
+
+		context("when a destination path is a link from an earlier build", func() {
+			it.Before(func() {
+				Expect(os.RemoveAll(filepath.Join(workingDir, "public", "assets"))).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(layerPath, "public-assets"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(layerPath, "public-assets", "application.css"), nil, 0600)).To(Succeed())
+				Expect(os.Symlink(filepath.Join(layerPath, "public-assets"), filepath.Join(workingDir, "public", "assets"))).To(Succeed())
+			})
+
+			it("does not warn", func() {
+				err := setup.ResetLocal(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(buffer.String()).NotTo(ContainSubstring("Warning"))
+			})
+		})
+	})
+
+	context("PreserveCommitted and RestoreCommitted", func() {
+		var stagingDir string
+
+		it.Before(func() {
+			var err error
+			stagingDir, err = os.MkdirTemp("", "staging")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.MkdirAll(filepath.Join(workingDir, "public", "assets", "widget"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets", "widget", "widget.js"), []byte("widget"), 0600)).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.RemoveAll(stagingDir)).To(Succeed())
+		})
+
+		it("copies the committed files into the layer", func() {
+			Expect(setup.PreserveCommitted(workingDir, stagingDir)).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("Preserving 1 committed file(s) from public/assets"))
+
+			Expect(setup.ResetLocal(workingDir)).To(Succeed())
+			Expect(setup.ResetLayer(layerPath, workingDir)).To(Succeed())
+			Expect(setup.RestoreCommitted(stagingDir, layerPath)).To(Succeed())
+
+			content, err := os.ReadFile(filepath.Join(layerPath, "public-assets", "widget", "widget.js"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal("widget"))
+		})
+
+		context("failure cases", func() {
+			context("when a destination path is a file", func() {
+				it.Before(func() {
+					Expect(os.RemoveAll(filepath.Join(workingDir, "public", "assets"))).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets"), nil, 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					err := setup.PreserveCommitted(workingDir, stagingDir)
+					Expect(err).To(MatchError("failed to preserve committed files in public/assets: it is a file, not a directory"))
+				})
+			})
+		})
 	})
 
 	context("ResetLayer", func() {
 		it("creates the directories", func() {
-			Expect(setup.ResetLayer(layerPath)).To(Succeed())
+			Expect(setup.ResetLayer(layerPath, workingDir)).To(Succeed())
 
 			Expect(filepath.Join(layerPath, "tmp-cache-assets")).To(BeADirectory())
 			Expect(filepath.Join(layerPath, "public-assets")).To(BeADirectory())
@@ -105,18 +202,70 @@ func testDirectorySetup(t *testing.T, context spec.G, it spec.S) {
 			})
 
 			it("creates the custom directories", func() {
-				Expect(setup.ResetLayer(layerPath)).To(Succeed())
+				Expect(setup.ResetLayer(layerPath, workingDir)).To(Succeed())
 
 				Expect(filepath.Join(layerPath, "tmp-cache-assets")).To(BeADirectory())
 				Expect(filepath.Join(layerPath, "public-assets")).To(BeADirectory())
 				Expect(filepath.Join(layerPath, "public-packs")).To(BeADirectory())
-				Expect(filepath.Join(layerPath, "public-some-gem")).To(BeADirectory())
-				Expect(filepath.Join(layerPath, "assets-other-gem")).To(BeADirectory())
+				Expect(filepath.Join(layerPath, "public-some_-gem")).To(BeADirectory())
+				Expect(filepath.Join(layerPath, "assets-other_-gem")).To(BeADirectory())
 				Expect(filepath.Join(layerPath, "another-assets-path")).To(BeADirectory())
 			})
 		})
 	})
 
+	context("when the layer has directories that are no longer configured", func() {
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(layerPath, "public-widgets"), os.ModePerm)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(layerPath, "env.launch"), os.ModePerm)).To(Succeed())
+		})
+
+		it("removes them and keeps the lifecycle directories", func() {
+			Expect(setup.ResetLayer(layerPath, workingDir)).To(Succeed())
+
+			Expect(filepath.Join(layerPath, "public-widgets")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(layerPath, "env.launch")).To(BeADirectory())
+			Expect(filepath.Join(layerPath, "public-assets")).To(BeADirectory())
+		})
+	})
+
+	context("when the layer holds the output of a previous build", func() {
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(layerPath, "public-assets", "admin"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(layerPath, "public-assets", ".manifest.json"), []byte(`{}`), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(layerPath, "public-assets", "application-old.js.gz"), nil, 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(layerPath, "public-assets", "admin", "admin-old.js.map"), nil, 0600)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(layerPath, "public-packs"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(layerPath, "public-packs", "manifest.json"), []byte(`{}`), 0600)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(layerPath, "tmp-cache-assets", "sprockets"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(layerPath, "tmp-cache-assets", "sprockets", "cache-entry"), nil, 0600)).To(Succeed())
+		})
+
+		it("removes the output and keeps the caches", func() {
+			Expect(setup.ResetLayer(layerPath, workingDir)).To(Succeed())
+
+			Expect(os.ReadDir(filepath.Join(layerPath, "public-assets"))).To(BeEmpty())
+			Expect(os.ReadDir(filepath.Join(layerPath, "public-packs"))).To(BeEmpty())
+			Expect(filepath.Join(layerPath, "tmp-cache-assets", "sprockets", "cache-entry")).To(BeAnExistingFile())
+		})
+	})
+
+	context("when the app uses shakapacker", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    shakapacker (7.2.0)\n"), 0600)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(workingDir, "tmp", "shakapacker"), os.ModePerm)).To(Succeed())
+		})
+
+		it("resets the shakapacker cache locally and creates it in the layer", func() {
+			Expect(setup.ResetLocal(workingDir)).To(Succeed())
+			Expect(filepath.Join(workingDir, "tmp", "shakapacker")).NotTo(BeADirectory())
+
+			Expect(setup.ResetLayer(layerPath, workingDir)).To(Succeed())
+			Expect(filepath.Join(layerPath, "tmp-shakapacker")).To(BeADirectory())
+			Expect(filepath.Join(layerPath, "public-packs")).To(BeADirectory())
+		})
+	})
+
 	context("Link", func() {
 		it.Before(func() {
 			err := os.MkdirAll(filepath.Join(workingDir, "public"), os.ModePerm)
@@ -143,6 +292,88 @@ func testDirectorySetup(t *testing.T, context spec.G, it spec.S) {
 			Expect(link).To(Equal(filepath.Join(layerPath, "public-packs")))
 		})
 
+		context("when the app uses shakapacker", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    shakapacker (7.2.0)\n"), 0600)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(workingDir, "config"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "config", "shakapacker.yml"), []byte("production:\n  public_output_path: js\n"), 0600)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(workingDir, "tmp"), os.ModePerm)).To(Succeed())
+			})
+
+			it("links the output and cache paths from the config", func() {
+				err := setup.Link(layerPath, workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				link, err := os.Readlink(filepath.Join(workingDir, "public", "js"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(link).To(Equal(filepath.Join(layerPath, "public-js")))
+
+				link, err = os.Readlink(filepath.Join(workingDir, "tmp", "shakapacker"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(link).To(Equal(filepath.Join(layerPath, "tmp-shakapacker")))
+			})
+
+			context("when the cache path is nested inside the output path", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "config", "shakapacker.yml"), []byte("production:\n  public_output_path: js\n  cache_path: public/js/cache\n"), 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					err := setup.Link(layerPath, workingDir)
+					Expect(err).To(MatchError(ContainSubstring(`it is nested inside "public/js"`)))
+				})
+
+				context("when discovery is skipped", func() {
+					it.Before(func() {
+						t.Setenv("BP_RAILS_ASSETS_SKIP_DESTINATION_DISCOVERY", "true")
+						t.Setenv("BP_RAILS_ASSETS_EXTRA_DESTINATION_PATHS", filepath.Join("public", "js"))
+					})
+
+					it("links only the listed paths", func() {
+						err := setup.Link(layerPath, workingDir)
+						Expect(err).NotTo(HaveOccurred())
+
+						link, err := os.Readlink(filepath.Join(workingDir, "public", "js"))
+						Expect(err).NotTo(HaveOccurred())
+						Expect(link).To(Equal(filepath.Join(layerPath, "public-js")))
+
+						Expect(filepath.Join(workingDir, "tmp", "shakapacker")).NotTo(BeAnExistingFile())
+					})
+				})
+			})
+		})
+
+		context("when the app sets config.assets.prefix", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(workingDir, "config"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "config", "application.rb"), []byte(`config.assets.prefix = "/static"`), 0600)).To(Succeed())
+			})
+
+			it("links the prefix directory", func() {
+				err := setup.Link(layerPath, workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				link, err := os.Readlink(filepath.Join(workingDir, "public", "static"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(link).To(Equal(filepath.Join(layerPath, "public-static")))
+			})
+		})
+
+		context("when the app uses vite ruby", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    vite_rails (3.0.17)\n    vite_ruby (3.5.0)\n"), 0600)).To(Succeed())
+			})
+
+			it("links the vite output directory", func() {
+				err := setup.Link(layerPath, workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				link, err := os.Readlink(filepath.Join(workingDir, "public", "vite"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(link).To(Equal(filepath.Join(layerPath, "public-vite")))
+			})
+		})
+
 		context("with custom directories", func() {
 			it.Before(func() {
 				t.Setenv("BP_RAILS_ASSETS_EXTRA_DESTINATION_PATHS", customAssetsPrecompilePaths)
@@ -172,16 +403,232 @@ func testDirectorySetup(t *testing.T, context spec.G, it spec.S) {
 
 				link, err = os.Readlink(filepath.Join(workingDir, "public", "some-gem"))
 				Expect(err).NotTo(HaveOccurred())
-				Expect(link).To(Equal(filepath.Join(layerPath, "public-some-gem")))
+				Expect(link).To(Equal(filepath.Join(layerPath, "public-some_-gem")))
 
 				link, err = os.Readlink(filepath.Join(workingDir, "assets", "other-gem"))
 				Expect(err).NotTo(HaveOccurred())
-				Expect(link).To(Equal(filepath.Join(layerPath, "assets-other-gem")))
+				Expect(link).To(Equal(filepath.Join(layerPath, "assets-other_-gem")))
 
 				link, err = os.Readlink(filepath.Join(workingDir, "another", "assets", "path"))
 				Expect(err).NotTo(HaveOccurred())
 				Expect(link).To(Equal(filepath.Join(layerPath, "another-assets-path")))
 			})
 		})
+
+		it("logs each link at the debug level", func() {
+			err := setup.Link(layerPath, workingDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring(fmt.Sprintf("public/assets -> %s", filepath.Join(layerPath, "public-assets"))))
+			Expect(buffer.String()).To(ContainSubstring(fmt.Sprintf("tmp/cache/assets -> %s", filepath.Join(layerPath, "tmp-cache-assets"))))
+		})
+
+		context("when the links already exist", func() {
+			it.Before(func() {
+				Expect(setup.Link(layerPath, workingDir)).To(Succeed())
+			})
+
+			it("replaces them", func() {
+				err := setup.Link(layerPath, workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				link, err := os.Readlink(filepath.Join(workingDir, "public", "assets"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(link).To(Equal(filepath.Join(layerPath, "public-assets")))
+			})
+		})
+
+		context("when a destination path is an empty directory", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(workingDir, "public", "assets"), os.ModePerm)).To(Succeed())
+			})
+
+			it("replaces it with a link", func() {
+				err := setup.Link(layerPath, workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				link, err := os.Readlink(filepath.Join(workingDir, "public", "assets"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(link).To(Equal(filepath.Join(layerPath, "public-assets")))
+			})
+		})
+
+		context("when the parent of a destination path does not exist", func() {
+			it.Before(func() {
+				Expect(os.RemoveAll(filepath.Join(workingDir, "tmp"))).To(Succeed())
+			})
+
+			it("creates it", func() {
+				err := setup.Link(layerPath, workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				link, err := os.Readlink(filepath.Join(workingDir, "tmp", "cache", "assets"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(link).To(Equal(filepath.Join(layerPath, "tmp-cache-assets")))
+			})
+		})
+
+		context("when the link mode is relative-symlink", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_LINK_MODE", "relative-symlink")
+			})
+
+			it("links with symlinks relative to the working directory", func() {
+				err := setup.Link(layerPath, workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				link, err := os.Readlink(filepath.Join(workingDir, "public", "assets"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(filepath.IsAbs(link)).To(BeFalse())
+				Expect(filepath.Join(workingDir, "public", link)).To(Equal(filepath.Join(layerPath, "public-assets")))
+
+				link, err = os.Readlink(filepath.Join(workingDir, "tmp", "cache", "assets"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(filepath.IsAbs(link)).To(BeFalse())
+				Expect(filepath.Join(workingDir, "tmp", "cache", link)).To(Equal(filepath.Join(layerPath, "tmp-cache-assets")))
+			})
+		})
+
+		context("failure cases", func() {
+			context("when a destination path is a file", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets"), []byte("some-content"), 0600)).To(Succeed())
+				})
+
+				it("returns an error and leaves the file in place", func() {
+					err := setup.Link(layerPath, workingDir)
+					Expect(err).To(MatchError("failed to link public/assets: it is a file; refusing to replace it with a link to the assets layer"))
+
+					Expect(filepath.Join(workingDir, "public", "assets")).To(BeARegularFile())
+				})
+			})
+
+			context("when a destination path is a directory with content", func() {
+				it.Before(func() {
+					Expect(os.MkdirAll(filepath.Join(workingDir, "public", "assets"), os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "public", "assets", "logo.png"), nil, 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					err := setup.Link(layerPath, workingDir)
+					Expect(err).To(MatchError("failed to link public/assets: it is a directory that is not empty; refusing to replace it with a link to the assets layer"))
+
+					Expect(filepath.Join(workingDir, "public", "assets", "logo.png")).To(BeARegularFile())
+				})
+			})
+
+			context("when a destination path is a symlink outside of the layer", func() {
+				it.Before(func() {
+					Expect(os.Symlink("/some/other/dir", filepath.Join(workingDir, "public", "assets"))).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					err := setup.Link(layerPath, workingDir)
+					Expect(err).To(MatchError(ContainSubstring("failed to link public/assets: it is a symlink to /some/other/dir, which is outside of the assets layer")))
+				})
+			})
+
+			context("when the link mode is invalid", func() {
+				it.Before(func() {
+					t.Setenv("BP_RAILS_ASSETS_LINK_MODE", "hardlink")
+				})
+
+				it("returns an error", func() {
+					err := setup.Link(layerPath, workingDir)
+					Expect(err).To(MatchError(ContainSubstring(`invalid BP_RAILS_ASSETS_LINK_MODE "hardlink"`)))
+				})
+			})
+		})
+	})
+
+	context("Materialize", func() {
+		it.Before(func() {
+			Expect(setup.ResetLocal(workingDir)).To(Succeed())
+			Expect(setup.ResetLayer(layerPath, workingDir)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(layerPath, "public-assets", "application.css"), []byte("body {}"), 0600)).To(Succeed())
+			Expect(setup.Link(layerPath, workingDir)).To(Succeed())
+		})
+
+		it("leaves the symlinks in place", func() {
+			err := setup.Materialize(layerPath, workingDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			info, err := os.Lstat(filepath.Join(workingDir, "public", "assets"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode() & os.ModeSymlink).NotTo(BeZero())
+		})
+
+		context("when the link mode is copy", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_LINK_MODE", "copy")
+			})
+
+			it("replaces the symlinks with copies of the layer directories", func() {
+				err := setup.Materialize(layerPath, workingDir)
+				Expect(err).NotTo(HaveOccurred())
+
+				for _, path := range []string{
+					filepath.Join("public", "assets"),
+					filepath.Join("public", "packs"),
+					filepath.Join("tmp", "cache", "assets"),
+				} {
+					info, err := os.Lstat(filepath.Join(workingDir, path))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.IsDir()).To(BeTrue(), path)
+				}
+
+				content, err := os.ReadFile(filepath.Join(workingDir, "public", "assets", "application.css"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(content)).To(Equal("body {}"))
+
+				Expect(filepath.Join(layerPath, "public-assets", "application.css")).To(BeARegularFile())
+			})
+		})
+	})
+
+	context("when destination paths differ only in separators and dashes", func() {
+		it.Before(func() {
+			t.Setenv("BP_RAILS_ASSETS_EXTRA_DESTINATION_PATHS", strings.Join([]string{
+				filepath.Join("public", "a-b"),
+				filepath.Join("public", "c", "d"),
+				filepath.Join("public", "c_d"),
+			}, string(filepath.ListSeparator)))
+		})
+
+		it("gives each path its own layer directory", func() {
+			Expect(setup.ResetLayer(layerPath, workingDir)).To(Succeed())
+
+			Expect(filepath.Join(layerPath, "public-a_-b")).To(BeADirectory())
+			Expect(filepath.Join(layerPath, "public-c-d")).To(BeADirectory())
+			Expect(filepath.Join(layerPath, "public-c__d")).To(BeADirectory())
+		})
+	})
+
+	context("failure cases", func() {
+		for _, example := range []struct {
+			name  string
+			paths []string
+			err   string
+		}{
+			{"an absolute path", []string{"/srv/assets"}, `invalid destination path "/srv/assets" (from $BP_RAILS_ASSETS_EXTRA_DESTINATION_PATHS): it must be relative to the application directory`},
+			{"a path outside the application", []string{"../assets"}, `invalid destination path "../assets" (from $BP_RAILS_ASSETS_EXTRA_DESTINATION_PATHS): it must not be outside of the application directory`},
+			{"the application directory", []string{"."}, `invalid destination path "." (from $BP_RAILS_ASSETS_EXTRA_DESTINATION_PATHS): it must not be the application directory itself`},
+			{"a duplicate path", []string{"public/gem", "public/gem/"}, `invalid destination path "public/gem/" (from $BP_RAILS_ASSETS_EXTRA_DESTINATION_PATHS): it is listed more than once`},
+			{"a nested path", []string{"public/assets/gem"}, `invalid destination path "public/assets/gem" (from $BP_RAILS_ASSETS_EXTRA_DESTINATION_PATHS): it is nested inside "public/assets" (from the buildpack defaults)`},
+		} {
+			example := example
+
+			context(fmt.Sprintf("when the destination paths include %s", example.name), func() {
+				it.Before(func() {
+					t.Setenv("BP_RAILS_ASSETS_EXTRA_DESTINATION_PATHS", strings.Join(example.paths, string(filepath.ListSeparator)))
+				})
+
+				it("returns an error", func() {
+					Expect(setup.ResetLocal(workingDir)).To(MatchError(example.err))
+					Expect(setup.ResetLayer(layerPath, workingDir)).To(MatchError(example.err))
+					Expect(setup.Link(layerPath, workingDir)).To(MatchError(example.err))
+				})
+			})
+		}
 	})
 }
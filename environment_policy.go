@@ -0,0 +1,137 @@
+package railsassets
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultEnvironmentDenylist is the set of environment variable name patterns
+// that are never passed to the "rails assets:precompile" build process. They
+// describe the internals of the buildpack lifecycle or may contain the
+// credentials of every service binding.
+var DefaultEnvironmentDenylist = []string{
+	"CNB_*",
+	"SERVICE_BINDING_ROOT",
+	"VCAP_SERVICES",
+}
+
+// DefaultEnvironmentAllowlist is the set of environment variable name
+// patterns that are passed to the "rails assets:precompile" build process
+// along with those in $BP_RAILS_ASSETS_ENV_ALLOWLIST. Without them, Ruby,
+// Bundler and Node.js cannot find their installations, gems and packages.
+var DefaultEnvironmentAllowlist = []string{
+	"PATH",
+	"HOME",
+	"USER",
+	"TMPDIR",
+	"TZ",
+	"LANG",
+	"LANGUAGE",
+	"LC_*",
+	"LD_LIBRARY_PATH",
+	"SSL_CERT_DIR",
+	"SSL_CERT_FILE",
+	"GEM_*",
+	"BUNDLE_*",
+	"BUNDLER_*",
+	"RUBY*",
+	"RAILS_ENV",
+	"RACK_ENV",
+	"NODE_ENV",
+	"NODE_HOME",
+	"NODE_OPTIONS",
+	"NODE_PATH",
+	"NODE_EXTRA_CA_CERTS",
+}
+
+// EnvironmentPolicy decides which variables of the buildpack environment are
+// passed to the "rails assets:precompile" build process.
+type EnvironmentPolicy struct {
+	Allowlist []string
+	Denylist  []string
+}
+
+// NewEnvironmentPolicy builds an EnvironmentPolicy from
+// $BP_RAILS_ASSETS_ENV_ALLOWLIST and $BP_RAILS_ASSETS_ENV_DENYLIST. Both
+// variables are lists of glob patterns (e.g. "AWS_*") with the same notation
+// as $PATH. When an allowlist is given, the DefaultEnvironmentAllowlist is
+// added to it. The DefaultEnvironmentDenylist is always applied.
+func NewEnvironmentPolicy(allowlist, denylist string) (EnvironmentPolicy, error) {
+	policy := EnvironmentPolicy{
+		Denylist: append([]string{}, DefaultEnvironmentDenylist...),
+	}
+
+	for _, pattern := range filepath.SplitList(allowlist) {
+		if pattern == "" {
+			continue
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			return EnvironmentPolicy{}, fmt.Errorf("failed to parse BP_RAILS_ASSETS_ENV_ALLOWLIST: invalid pattern %q: %w", pattern, err)
+		}
+		policy.Allowlist = append(policy.Allowlist, pattern)
+	}
+
+	if len(policy.Allowlist) > 0 {
+		policy.Allowlist = append(append([]string{}, DefaultEnvironmentAllowlist...), policy.Allowlist...)
+	}
+
+	for _, pattern := range filepath.SplitList(denylist) {
+		if pattern == "" {
+			continue
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			return EnvironmentPolicy{}, fmt.Errorf("failed to parse BP_RAILS_ASSETS_ENV_DENYLIST: invalid pattern %q: %w", pattern, err)
+		}
+		policy.Denylist = append(policy.Denylist, pattern)
+	}
+
+	return policy, nil
+}
+
+// Filter returns the variables in env that the policy permits. When an
+// allowlist is configured, only variables matching it are kept. Variables matching the denylist are always removed.
+func (p EnvironmentPolicy) Filter(env []string) []string {
+	var filtered []string
+	for _, pair := range env {
+		name, _, _ := strings.Cut(pair, "=")
+
+		if len(p.Allowlist) > 0 && !matchesAny(name, p.Allowlist) {
+			continue
+		}
+
+		if matchesAny(name, p.Denylist) {
+			continue
+		}
+
+		filtered = append(filtered, pair)
+	}
+
+	return filtered
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// environmentNames returns the sorted names of the variables in env.
+func environmentNames(env []string) []string {
+	var names []string
+	for _, pair := range env {
+		name, _, _ := strings.Cut(pair, "=")
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
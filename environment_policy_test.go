@@ -0,0 +1,104 @@
+package railsassets_test
+
+import (
+	"testing"
+
+	railsassets "github.com/paketo-buildpacks/rails-assets"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testEnvironmentPolicy(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	env := []string{
+		"PATH=/usr/bin",
+		"HOME=/home/cnb",
+		"CNB_PLATFORM_API=0.12",
+		"CNB_LAYERS_DIR=/layers",
+		"VCAP_SERVICES={}",
+		"AWS_ACCESS_KEY_ID=some-key",
+		"AWS_REGION=us-east-1",
+		"NODE_OPTIONS=--max-old-space-size=2048",
+		"BUNDLE_GEMFILE=/workspace/Gemfile",
+		"GEM_HOME=/layers/gems",
+		"LANG=C.UTF-8",
+	}
+
+	context("Filter", func() {
+		it("removes the default denylist", func() {
+			policy, err := railsassets.NewEnvironmentPolicy("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(policy.Filter(env)).To(Equal([]string{
+				"PATH=/usr/bin",
+				"HOME=/home/cnb",
+				"AWS_ACCESS_KEY_ID=some-key",
+				"AWS_REGION=us-east-1",
+				"NODE_OPTIONS=--max-old-space-size=2048",
+				"BUNDLE_GEMFILE=/workspace/Gemfile",
+				"GEM_HOME=/layers/gems",
+				"LANG=C.UTF-8",
+			}))
+		})
+
+		context("when there is a denylist", func() {
+			it("also removes the variables matching the denylist", func() {
+				policy, err := railsassets.NewEnvironmentPolicy("", "AWS_*:SOME_OTHER")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(policy.Filter(env)).To(Equal([]string{
+					"PATH=/usr/bin",
+					"HOME=/home/cnb",
+					"NODE_OPTIONS=--max-old-space-size=2048",
+					"BUNDLE_GEMFILE=/workspace/Gemfile",
+					"GEM_HOME=/layers/gems",
+					"LANG=C.UTF-8",
+				}))
+			})
+		})
+
+		context("when there is an allowlist", func() {
+			it("keeps the default allowlist and the variables matching the allowlist", func() {
+				policy, err := railsassets.NewEnvironmentPolicy("AWS_REGION:CNB_*", "")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(policy.Filter(env)).To(Equal([]string{
+					"PATH=/usr/bin",
+					"HOME=/home/cnb",
+					"AWS_REGION=us-east-1",
+					"NODE_OPTIONS=--max-old-space-size=2048",
+					"BUNDLE_GEMFILE=/workspace/Gemfile",
+					"GEM_HOME=/layers/gems",
+					"LANG=C.UTF-8",
+				}))
+			})
+
+			context("when the denylist matches a variable in the default allowlist", func() {
+				it("removes it", func() {
+					policy, err := railsassets.NewEnvironmentPolicy("AWS_REGION", "BUNDLE_*")
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(policy.Filter(env)).NotTo(ContainElement("BUNDLE_GEMFILE=/workspace/Gemfile"))
+				})
+			})
+		})
+	})
+
+	context("failure cases", func() {
+		context("when the allowlist contains an invalid pattern", func() {
+			it("returns an error", func() {
+				_, err := railsassets.NewEnvironmentPolicy("[AWS", "")
+				Expect(err).To(MatchError(ContainSubstring(`failed to parse BP_RAILS_ASSETS_ENV_ALLOWLIST: invalid pattern "[AWS"`)))
+			})
+		})
+
+		context("when the denylist contains an invalid pattern", func() {
+			it("returns an error", func() {
+				_, err := railsassets.NewEnvironmentPolicy("", "[AWS")
+				Expect(err).To(MatchError(ContainSubstring(`failed to parse BP_RAILS_ASSETS_ENV_DENYLIST: invalid pattern "[AWS"`)))
+			})
+		})
+	})
+}
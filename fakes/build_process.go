@@ -7,22 +7,24 @@ type BuildProcess struct {
 		sync.Mutex
 		CallCount int
 		Receives  struct {
-			WorkingDir string
+			WorkingDir  string
+			PlatformDir string
 		}
 		Returns struct {
 			Error error
 		}
-		Stub func(string) error
+		Stub func(string, string) error
 	}
 }
 
-func (f *BuildProcess) Execute(param1 string) error {
+func (f *BuildProcess) Execute(param1 string, param2 string) error {
 	f.ExecuteCall.Lock()
 	defer f.ExecuteCall.Unlock()
 	f.ExecuteCall.CallCount++
 	f.ExecuteCall.Receives.WorkingDir = param1
+	f.ExecuteCall.Receives.PlatformDir = param2
 	if f.ExecuteCall.Stub != nil {
-		return f.ExecuteCall.Stub(param1)
+		return f.ExecuteCall.Stub(param1, param2)
 	}
 	return f.ExecuteCall.Returns.Error
 }
@@ -15,16 +15,41 @@ type EnvironmentSetup struct {
 		}
 		Stub func(string, string) error
 	}
+	MaterializeCall struct {
+		sync.Mutex
+		CallCount int
+		Receives  struct {
+			LayerPath  string
+			WorkingDir string
+		}
+		Returns struct {
+			Error error
+		}
+		Stub func(string, string) error
+	}
+	PreserveCommittedCall struct {
+		sync.Mutex
+		CallCount int
+		Receives  struct {
+			WorkingDir string
+			StagingDir string
+		}
+		Returns struct {
+			Error error
+		}
+		Stub func(string, string) error
+	}
 	ResetLayerCall struct {
 		sync.Mutex
 		CallCount int
 		Receives  struct {
-			LayerPath string
+			LayerPath  string
+			WorkingDir string
 		}
 		Returns struct {
 			Error error
 		}
-		Stub func(string) error
+		Stub func(string, string) error
 	}
 	ResetLocalCall struct {
 		sync.Mutex
@@ -37,6 +62,18 @@ type EnvironmentSetup struct {
 		}
 		Stub func(string) error
 	}
+	RestoreCommittedCall struct {
+		sync.Mutex
+		CallCount int
+		Receives  struct {
+			StagingDir string
+			LayerPath  string
+		}
+		Returns struct {
+			Error error
+		}
+		Stub func(string, string) error
+	}
 }
 
 func (f *EnvironmentSetup) Link(param1 string, param2 string) error {
@@ -50,13 +87,36 @@ func (f *EnvironmentSetup) Link(param1 string, param2 string) error {
 	}
 	return f.LinkCall.Returns.Error
 }
-func (f *EnvironmentSetup) ResetLayer(param1 string) error {
+func (f *EnvironmentSetup) Materialize(param1 string, param2 string) error {
+	f.MaterializeCall.Lock()
+	defer f.MaterializeCall.Unlock()
+	f.MaterializeCall.CallCount++
+	f.MaterializeCall.Receives.LayerPath = param1
+	f.MaterializeCall.Receives.WorkingDir = param2
+	if f.MaterializeCall.Stub != nil {
+		return f.MaterializeCall.Stub(param1, param2)
+	}
+	return f.MaterializeCall.Returns.Error
+}
+func (f *EnvironmentSetup) PreserveCommitted(param1 string, param2 string) error {
+	f.PreserveCommittedCall.Lock()
+	defer f.PreserveCommittedCall.Unlock()
+	f.PreserveCommittedCall.CallCount++
+	f.PreserveCommittedCall.Receives.WorkingDir = param1
+	f.PreserveCommittedCall.Receives.StagingDir = param2
+	if f.PreserveCommittedCall.Stub != nil {
+		return f.PreserveCommittedCall.Stub(param1, param2)
+	}
+	return f.PreserveCommittedCall.Returns.Error
+}
+func (f *EnvironmentSetup) ResetLayer(param1 string, param2 string) error {
 	f.ResetLayerCall.Lock()
 	defer f.ResetLayerCall.Unlock()
 	f.ResetLayerCall.CallCount++
 	f.ResetLayerCall.Receives.LayerPath = param1
+	f.ResetLayerCall.Receives.WorkingDir = param2
 	if f.ResetLayerCall.Stub != nil {
-		return f.ResetLayerCall.Stub(param1)
+		return f.ResetLayerCall.Stub(param1, param2)
 	}
 	return f.ResetLayerCall.Returns.Error
 }
@@ -70,3 +130,14 @@ func (f *EnvironmentSetup) ResetLocal(param1 string) error {
 	}
 	return f.ResetLocalCall.Returns.Error
 }
+func (f *EnvironmentSetup) RestoreCommitted(param1 string, param2 string) error {
+	f.RestoreCommittedCall.Lock()
+	defer f.RestoreCommittedCall.Unlock()
+	f.RestoreCommittedCall.CallCount++
+	f.RestoreCommittedCall.Receives.StagingDir = param1
+	f.RestoreCommittedCall.Receives.LayerPath = param2
+	if f.RestoreCommittedCall.Stub != nil {
+		return f.RestoreCommittedCall.Stub(param1, param2)
+	}
+	return f.RestoreCommittedCall.Returns.Error
+}
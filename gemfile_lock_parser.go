@@ -0,0 +1,110 @@
+package railsassets
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GemfileLock holds the set of gems, and their resolved versions, that are
+// listed in the specs sections of a Gemfile.lock.
+type GemfileLock struct {
+	Gems map[string]string
+}
+
+// Has returns true when the lockfile includes the given gem.
+func (l GemfileLock) Has(name string) bool {
+	_, ok := l.Gems[name]
+	return ok
+}
+
+// RailsVersionAtLeast returns true when the locked "rails" (or "railties")
+// version is at least major.minor. It returns false when the version cannot
+// be determined.
+func (l GemfileLock) RailsVersionAtLeast(major, minor int) bool {
+	version, ok := l.Gems["rails"]
+	if !ok {
+		version, ok = l.Gems["railties"]
+		if !ok {
+			return false
+		}
+	}
+
+	segments := strings.SplitN(version, ".", 3)
+	if len(segments) < 2 {
+		return false
+	}
+
+	actualMajor, err := strconv.Atoi(segments[0])
+	if err != nil {
+		return false
+	}
+
+	actualMinor, err := strconv.Atoi(segments[1])
+	if err != nil {
+		return false
+	}
+
+	if actualMajor != major {
+		return actualMajor > major
+	}
+
+	return actualMinor >= minor
+}
+
+// GemfileLockParser parses the Gemfile.lock to determine which gems, and which
+// versions of those gems, the application has resolved.
+type GemfileLockParser struct{}
+
+// NewGemfileLockParser initializes a GemfileLockParser instance.
+func NewGemfileLockParser() GemfileLockParser {
+	return GemfileLockParser{}
+}
+
+// Parse scans the specs sections of the Gemfile.lock. A missing lockfile
+// results in an empty GemfileLock.
+func (p GemfileLockParser) Parse(path string) (GemfileLock, error) {
+	lock := GemfileLock{Gems: map[string]string{}}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return lock, nil
+		}
+
+		return GemfileLock{}, fmt.Errorf("failed to parse Gemfile.lock: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			_ = err
+		}
+	}()
+
+	specRe := regexp.MustCompile(`^    ([^\s(]+) \(([^)]+)\)$`)
+	scanner := bufio.NewScanner(file)
+
+	inSpecs := false
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "  specs:":
+			inSpecs = true
+		case !strings.HasPrefix(line, "    "):
+			inSpecs = false
+		case inSpecs:
+			if matches := specRe.FindStringSubmatch(line); matches != nil {
+				lock.Gems[matches[1]] = strings.SplitN(matches[2], "-", 2)[0]
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return GemfileLock{}, fmt.Errorf("failed to parse Gemfile.lock: %w", err)
+	}
+
+	return lock, nil
+}
@@ -0,0 +1,122 @@
+package railsassets_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	railsassets "github.com/paketo-buildpacks/rails-assets"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testGemfileLockParser(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		path   string
+		parser railsassets.GemfileLockParser
+	)
+
+	it.Before(func() {
+		dir, err := os.MkdirTemp("", "gemfile-lock")
+		Expect(err).NotTo(HaveOccurred())
+
+		path = filepath.Join(dir, "Gemfile.lock")
+
+		parser = railsassets.NewGemfileLockParser()
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(filepath.Dir(path))).To(Succeed())
+	})
+
+	context("Parse", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(path, []byte(`GIT
+  remote: https://github.com/rails/propshaft.git
+  revision: 1234567
+  specs:
+    propshaft (1.1.0)
+      actionpack (>= 7.0.0)
+
+GEM
+  remote: https://rubygems.org/
+  specs:
+    nokogiri (1.16.0-x86_64-linux)
+      racc (~> 1.4)
+    rails (7.1.3.2)
+      railties (= 7.1.3.2)
+    railties (7.1.3.2)
+
+PLATFORMS
+  x86_64-linux
+
+DEPENDENCIES
+  rails (~> 7.1)
+
+BUNDLED WITH
+   2.5.6
+`), 0600)).To(Succeed())
+		})
+
+		it("returns the locked gems and versions", func() {
+			lock, err := parser.Parse(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lock.Gems).To(Equal(map[string]string{
+				"propshaft": "1.1.0",
+				"nokogiri":  "1.16.0",
+				"rails":     "7.1.3.2",
+				"railties":  "7.1.3.2",
+			}))
+			Expect(lock.Has("propshaft")).To(BeTrue())
+			Expect(lock.Has("racc")).To(BeFalse())
+		})
+
+		context("when the Gemfile.lock does not exist", func() {
+			it.Before(func() {
+				Expect(os.Remove(path)).To(Succeed())
+			})
+
+			it("returns an empty lock", func() {
+				lock, err := parser.Parse(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(lock.Gems).To(BeEmpty())
+			})
+		})
+
+		context("failure cases", func() {
+			context("when the Gemfile.lock cannot be read", func() {
+				it.Before(func() {
+					Expect(os.Remove(path)).To(Succeed())
+					Expect(os.Mkdir(path, os.ModePerm)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := parser.Parse(path)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse Gemfile.lock:")))
+				})
+			})
+		})
+	})
+
+	context("RailsVersionAtLeast", func() {
+		it("compares the locked rails version", func() {
+			lock := railsassets.GemfileLock{Gems: map[string]string{"rails": "7.1.0.beta1"}}
+			Expect(lock.RailsVersionAtLeast(7, 1)).To(BeTrue())
+			Expect(lock.RailsVersionAtLeast(7, 2)).To(BeFalse())
+			Expect(lock.RailsVersionAtLeast(6, 9)).To(BeTrue())
+			Expect(lock.RailsVersionAtLeast(8, 0)).To(BeFalse())
+		})
+
+		it("falls back to railties", func() {
+			lock := railsassets.GemfileLock{Gems: map[string]string{"railties": "8.0.1"}}
+			Expect(lock.RailsVersionAtLeast(7, 1)).To(BeTrue())
+		})
+
+		it("returns false when the version is unknown", func() {
+			Expect(railsassets.GemfileLock{}.RailsVersionAtLeast(7, 1)).To(BeFalse())
+		})
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strings"
 )
 
 // GemfileParser parses the Gemfile to confirm that the application is using
@@ -45,3 +46,66 @@ func (p GemfileParser) Parse(path string) (bool, error) {
 
 	return false, nil
 }
+
+var (
+	gemfileGemRe        = regexp.MustCompile(`^\s*gem\s*\(?\s*["']([^"']+)["'](.*)$`)
+	gemfileGroupOptRe   = regexp.MustCompile(`(?:\bgroups?:|:groups?\s*=>)`)
+	gemfileGroupBlockRe = regexp.MustCompile(`^\s*group\b`)
+	gemfileBlockRe      = regexp.MustCompile(`(?:\bdo(?:\s*\|[^|]*\|)?|^\s*(?:if|unless|case|begin|while|until)\b.*)\s*(?:#.*)?$`)
+	gemfileEndRe        = regexp.MustCompile(`^\s*end\b`)
+)
+
+// InDefaultGroup scans the Gemfile for a "gem" declaration of the named gem
+// that is outside of any "group" block and has no "group" option, so that
+// Bundler installs it whatever $BUNDLE_WITHOUT excludes.
+func (p GemfileParser) InDefaultGroup(path, name string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to parse Gemfile: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			_ = err
+		}
+	}()
+
+	// Each open block records whether it is a "group" block.
+	var blocks []bool
+	inGroup := func() bool {
+		for _, group := range blocks {
+			if group {
+				return true
+			}
+		}
+		return false
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		if match := gemfileGemRe.FindStringSubmatch(line); match != nil {
+			if match[1] == name && !inGroup() && !gemfileGroupOptRe.MatchString(match[2]) {
+				return true, nil
+			}
+		}
+
+		switch {
+		case gemfileEndRe.MatchString(line):
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+		case gemfileBlockRe.MatchString(line):
+			blocks = append(blocks, gemfileGroupBlockRe.MatchString(line))
+		}
+	}
+
+	return false, scanner.Err()
+}
@@ -1,6 +1,7 @@
 package railsassets_test
 
 import (
+	"fmt"
 	"os"
 	"testing"
 
@@ -85,4 +86,66 @@ end
 			})
 		})
 	})
+
+	context("InDefaultGroup", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(path, []byte(`source "https://rubygems.org"
+
+gem "rails", "~> 7.1"
+gem "pg"
+
+platforms :mri do
+  gem "bootsnap", require: false
+end
+
+group :development, :test do
+  gem "sqlite3"
+  if ENV["CI"]
+    gem "rspec-rails"
+  end
+  gem "debug"
+end
+
+gem "puma"
+gem "rubocop", group: :development
+gem "capybara", :group => :test
+# gem "redis"
+`), 0600)).To(Succeed())
+		})
+
+		for _, example := range []struct {
+			gem      string
+			expected bool
+		}{
+			{"rails", true},
+			{"bootsnap", true},
+			{"puma", true},
+			{"sqlite3", false},
+			{"rspec-rails", false},
+			{"debug", false},
+			{"rubocop", false},
+			{"capybara", false},
+			{"redis", false},
+		} {
+			example := example
+
+			it(fmt.Sprintf("reports whether %s is in the default group", example.gem), func() {
+				inDefault, err := parser.InDefaultGroup(path, example.gem)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(inDefault).To(Equal(example.expected))
+			})
+		}
+
+		context("when the Gemfile file does not exist", func() {
+			it.Before(func() {
+				Expect(os.Remove(path)).To(Succeed())
+			})
+
+			it("returns false", func() {
+				inDefault, err := parser.InDefaultGroup(path, "rails")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(inDefault).To(BeFalse())
+			})
+		})
+	})
 }
@@ -0,0 +1,380 @@
+package railsassets
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ImageOptimizationResult counts the images that were made smaller and the
+// bytes that were saved.
+type ImageOptimizationResult struct {
+	Files int
+	Bytes int64
+}
+
+// OptimizeImages losslessly re-encodes the PNG, JPEG and GIF files in the
+// output directories of the asset pipelines, and replaces a file in place when
+// the result is smaller. The integrity hashes and sizes that the manifests
+// record for the replaced files are updated. Their names, and the digests
+// recorded next to them, still refer to the original content.
+//
+//   - PNG files are re-encoded at the highest compression level, keeping
+//     their colour space chunks and dropping text and other metadata.
+//     Animated PNG files are left alone.
+//   - JPEG files keep their compressed image data and lose their comments and
+//     EXIF, XMP and IPTC metadata. EXIF metadata is kept when it rotates the
+//     image.
+//   - GIF files are re-encoded frame by frame.
+//
+// Images that cannot be decoded are left alone. Files are optimized in
+// parallel, one per CPU.
+func OptimizeImages(workingDir string) (ImageOptimizationResult, error) {
+	files, err := compiledFiles(workingDir)
+	if err != nil {
+		return ImageOptimizationResult{}, err
+	}
+
+	var images []string
+	for _, path := range files {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".png", ".jpg", ".jpeg", ".gif":
+			images = append(images, path)
+		}
+	}
+
+	var (
+		mutex   sync.Mutex
+		result  ImageOptimizationResult
+		changed = map[string]bool{}
+	)
+
+	err = inParallel(images, func(path string) error {
+		saved, err := optimizeImage(path)
+		if err != nil {
+			return err
+		}
+
+		if saved > 0 {
+			mutex.Lock()
+			result.Files++
+			result.Bytes += saved
+			changed[path] = true
+			mutex.Unlock()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return ImageOptimizationResult{}, err
+	}
+
+	if len(changed) == 0 {
+		return result, nil
+	}
+
+	lock, err := NewGemfileLockParser().Parse(filepath.Join(workingDir, "Gemfile.lock"))
+	if err != nil {
+		return ImageOptimizationResult{}, err
+	}
+
+	locations, _, err := findAssetManifests(workingDir, lock)
+	if err != nil {
+		return ImageOptimizationResult{}, err
+	}
+
+	for _, location := range locations {
+		err = updateManifest(workingDir, location, nil, changed)
+		if err != nil {
+			return ImageOptimizationResult{}, err
+		}
+	}
+
+	return result, nil
+}
+
+// optimizeImage optimizes an image in place and returns the number of bytes
+// that were saved.
+func optimizeImage(path string) (int64, error) {
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var optimized []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		optimized, err = optimizePNG(original)
+	case ".gif":
+		optimized, err = optimizeGIF(original)
+	default:
+		optimized, err = stripJPEGMetadata(original)
+	}
+
+	// Images that cannot be decoded are served as they are.
+	if err != nil || len(optimized) >= len(original) {
+		return 0, nil
+	}
+
+	err = replaceFile(path, optimized)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(original) - len(optimized)), nil
+}
+
+// replaceFile writes the content to a temporary file next to the path and
+// renames it over the path, keeping its permissions.
+func replaceFile(path string, content []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	_, err = file.Write(content)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	err = file.Chmod(info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(file.Name(), path)
+	if err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+
+	return nil
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngChunk is a chunk of a PNG file. Raw holds the whole chunk, including its
+// length, type and checksum.
+type pngChunk struct {
+	Type string
+	Raw  []byte
+}
+
+// pngColorChunks describe how the colours of an image are to be displayed,
+// and are carried over when a PNG is re-encoded.
+var pngColorChunks = map[string]bool{
+	"cHRM": true,
+	"gAMA": true,
+	"iCCP": true,
+	"sRGB": true,
+}
+
+// optimizePNG re-encodes a PNG at the highest compression level. The image is
+// returned unchanged when it is animated, or when the encoder would change its
+// colour type or bit depth.
+func optimizePNG(data []byte) ([]byte, error) {
+	chunks, err := parsePNGChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, chunk := range chunks {
+		if chunk.Type == "acTL" {
+			return data, nil
+		}
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	err = encoder.Encode(&buffer, img)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := parsePNGChunks(buffer.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	// The bit depth and colour type are the 9th and 10th bytes of the IHDR
+	// data, which follows the 8 byte chunk header.
+	if !bytes.Equal(chunks[0].Raw[16:18], encoded[0].Raw[16:18]) {
+		return data, nil
+	}
+
+	optimized := append([]byte{}, pngSignature...)
+	optimized = append(optimized, encoded[0].Raw...)
+	for _, chunk := range chunks {
+		if pngColorChunks[chunk.Type] {
+			optimized = append(optimized, chunk.Raw...)
+		}
+	}
+	for _, chunk := range encoded[1:] {
+		optimized = append(optimized, chunk.Raw...)
+	}
+
+	return optimized, nil
+}
+
+// parsePNGChunks splits a PNG file into its chunks, the first of which is
+// always IHDR.
+func parsePNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("not a PNG file")
+	}
+
+	var chunks []pngChunk
+	for offset := len(pngSignature); offset < len(data); {
+		if offset+8 > len(data) {
+			return nil, errors.New("truncated PNG chunk")
+		}
+
+		end := offset + 12 + int(binary.BigEndian.Uint32(data[offset:]))
+		if end > len(data) || end < offset {
+			return nil, errors.New("truncated PNG chunk")
+		}
+
+		chunks = append(chunks, pngChunk{Type: string(data[offset+4 : offset+8]), Raw: data[offset:end]})
+		offset = end
+	}
+
+	if len(chunks) == 0 || chunks[0].Type != "IHDR" || len(chunks[0].Raw) < 25 {
+		return nil, errors.New("PNG file does not start with IHDR")
+	}
+
+	return chunks, nil
+}
+
+// optimizeGIF re-encodes every frame of a GIF, keeping their timing, disposal
+// and the loop count.
+func optimizeGIF(data []byte) ([]byte, error) {
+	img, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	err = gif.EncodeAll(&buffer, img)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// stripJPEGMetadata removes comments and metadata segments from a JPEG
+// without decoding it. The JFIF header, the ICC profile and the Adobe segment,
+// which affect how the image is displayed, are kept.
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errors.New("not a JPEG file")
+	}
+
+	stripped := []byte{0xFF, 0xD8}
+	for offset := 2; offset+4 <= len(data); {
+		if data[offset] != 0xFF {
+			return nil, errors.New("malformed JPEG segment")
+		}
+
+		marker := data[offset+1]
+		switch {
+		case marker == 0xFF:
+			offset++
+			continue
+
+		// The start of scan is followed by the compressed image data, which
+		// is copied along with everything after it.
+		case marker == 0xDA:
+			return append(stripped, data[offset:]...), nil
+		}
+
+		end := offset + 2 + int(binary.BigEndian.Uint16(data[offset+2:]))
+		if end > len(data) || end < offset+4 {
+			return nil, errors.New("truncated JPEG segment")
+		}
+
+		segment := data[offset:end]
+		if !isJPEGMetadata(marker, segment) {
+			stripped = append(stripped, segment...)
+		}
+		offset = end
+	}
+
+	return nil, errors.New("JPEG file has no image data")
+}
+
+// isJPEGMetadata reports whether a segment holds a comment or metadata that
+// does not affect how the image is displayed.
+func isJPEGMetadata(marker byte, segment []byte) bool {
+	switch {
+	case marker == 0xFE:
+		return true
+	case marker == 0xE1:
+		return exifOrientation(segment[4:]) == 1
+	case marker >= 0xE3 && marker <= 0xED, marker == 0xEF:
+		return true
+	default:
+		return false
+	}
+}
+
+// exifOrientation returns the orientation recorded in an APP1 segment, or 1,
+// the default, when the segment holds no EXIF data or no orientation.
+func exifOrientation(data []byte) uint16 {
+	tiff, ok := bytes.CutPrefix(data, []byte("Exif\x00\x00"))
+	if !ok || len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := range count {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return order.Uint16(tiff[entry+8:])
+		}
+	}
+
+	return 1
+}
@@ -0,0 +1,320 @@
+package railsassets_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	railsassets "github.com/paketo-buildpacks/rails-assets"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testImageOptimization(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+		assetsDir  string
+		picture    *image.NRGBA
+	)
+
+	pngChunk := func(kind string, data []byte) []byte {
+		chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+		chunk = append(chunk, kind...)
+		chunk = append(chunk, data...)
+		return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	}
+
+	// withPNGChunks inserts chunks after the IHDR chunk, which is 25 bytes
+	// long and follows the 8 byte signature.
+	withPNGChunks := func(data []byte, chunks ...[]byte) []byte {
+		result := append([]byte{}, data[:33]...)
+		for _, chunk := range chunks {
+			result = append(result, chunk...)
+		}
+		return append(result, data[33:]...)
+	}
+
+	// withJPEGSegments inserts segments after the start of image marker.
+	withJPEGSegments := func(data []byte, segments ...[]byte) []byte {
+		result := append([]byte{}, data[:2]...)
+		for _, segment := range segments {
+			result = append(result, segment...)
+		}
+		return append(result, data[2:]...)
+	}
+
+	jpegSegment := func(marker byte, data []byte) []byte {
+		segment := []byte{0xFF, marker}
+		segment = binary.BigEndian.AppendUint16(segment, uint16(len(data)+2))
+		return append(segment, data...)
+	}
+
+	exif := func(orientation uint16) []byte {
+		data := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+		data = append(data, 0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01)
+		data = binary.BigEndian.AppendUint16(data, orientation)
+		data = append(data, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00)
+		return append(data, bytes.Repeat([]byte{0}, 512)...)
+	}
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		assetsDir = filepath.Join(workingDir, "public", "assets")
+		Expect(os.MkdirAll(assetsDir, os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    propshaft (1.1.0)\n"), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(assetsDir, ".manifest.json"), []byte(`{}`), 0600)).To(Succeed())
+
+		picture = image.NewNRGBA(image.Rect(0, 0, 64, 64))
+		for x := range 64 {
+			for y := range 64 {
+				picture.Set(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 4), B: 128, A: 255})
+			}
+		}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("OptimizeImages", func() {
+		context("when there is a PNG", func() {
+			var original []byte
+
+			it.Before(func() {
+				var buffer bytes.Buffer
+				encoder := png.Encoder{CompressionLevel: png.NoCompression}
+				Expect(encoder.Encode(&buffer, picture)).To(Succeed())
+
+				original = withPNGChunks(buffer.Bytes(),
+					pngChunk("gAMA", []byte{0x00, 0x00, 0xb1, 0x8f}),
+					pngChunk("tEXt", []byte("Software\x00Some Editor")),
+				)
+				Expect(os.WriteFile(filepath.Join(assetsDir, "logo-abc.png"), original, 0644)).To(Succeed())
+			})
+
+			it("re-encodes it without changing the pixels", func() {
+				result, err := railsassets.OptimizeImages(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Files).To(Equal(1))
+
+				optimized, err := os.ReadFile(filepath.Join(assetsDir, "logo-abc.png"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Bytes).To(Equal(int64(len(original) - len(optimized))))
+
+				Expect(optimized).To(ContainSubstring("gAMA"))
+				Expect(optimized).NotTo(ContainSubstring("tEXt"))
+
+				decoded, err := png.Decode(bytes.NewReader(optimized))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(decoded.Bounds()).To(Equal(picture.Bounds()))
+				for x := range 64 {
+					for y := range 64 {
+						Expect(color.NRGBAModel.Convert(decoded.At(x, y))).To(Equal(picture.At(x, y)))
+					}
+				}
+
+				info, err := os.Stat(filepath.Join(assetsDir, "logo-abc.png"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0644)))
+			})
+
+			context("when the app uses sprockets", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    sprockets-rails (3.4.2)\n"), 0600)).To(Succeed())
+					Expect(os.Remove(filepath.Join(assetsDir, ".manifest.json"))).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(assetsDir, ".sprockets-manifest-0123.json"), []byte(`{
+  "files": {
+    "logo-abc.png": {"logical_path": "logo.png", "size": 123, "digest": "abc", "integrity": "sha256-old"}
+  },
+  "assets": {"logo.png": "logo-abc.png"}
+}`), 0600)).To(Succeed())
+				})
+
+				it("updates the integrity and size in the manifest", func() {
+					_, err := railsassets.OptimizeImages(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+
+					optimized, err := os.ReadFile(filepath.Join(assetsDir, "logo-abc.png"))
+					Expect(err).NotTo(HaveOccurred())
+					sum := sha256.Sum256(optimized)
+
+					content, err := os.ReadFile(filepath.Join(assetsDir, ".sprockets-manifest-0123.json"))
+					Expect(err).NotTo(HaveOccurred())
+
+					var manifest struct {
+						Files map[string]map[string]interface{} `json:"files"`
+					}
+					Expect(json.Unmarshal(content, &manifest)).To(Succeed())
+					Expect(manifest.Files["logo-abc.png"]).To(Equal(map[string]interface{}{
+						"logical_path": "logo.png",
+						"size":         float64(len(optimized)),
+						"digest":       "abc",
+						"integrity":    "sha256-" + base64.StdEncoding.EncodeToString(sum[:]),
+					}))
+				})
+
+				context("when public/assets is a link into a layer", func() {
+					var layerDir string
+
+					it.Before(func() {
+						var err error
+						layerDir, err = os.MkdirTemp("", "layer")
+						Expect(err).NotTo(HaveOccurred())
+
+						Expect(os.Rename(assetsDir, filepath.Join(layerDir, "public-assets"))).To(Succeed())
+						Expect(os.Symlink(filepath.Join(layerDir, "public-assets"), assetsDir)).To(Succeed())
+					})
+
+					it.After(func() {
+						Expect(os.RemoveAll(layerDir)).To(Succeed())
+					})
+
+					it("updates the integrity and size in the manifest", func() {
+						_, err := railsassets.OptimizeImages(workingDir)
+						Expect(err).NotTo(HaveOccurred())
+
+						optimized, err := os.ReadFile(filepath.Join(assetsDir, "logo-abc.png"))
+						Expect(err).NotTo(HaveOccurred())
+						sum := sha256.Sum256(optimized)
+
+						content, err := os.ReadFile(filepath.Join(assetsDir, ".sprockets-manifest-0123.json"))
+						Expect(err).NotTo(HaveOccurred())
+
+						var manifest struct {
+							Files map[string]map[string]interface{} `json:"files"`
+						}
+						Expect(json.Unmarshal(content, &manifest)).To(Succeed())
+						Expect(manifest.Files["logo-abc.png"]).To(HaveKeyWithValue("size", float64(len(optimized))))
+						Expect(manifest.Files["logo-abc.png"]).To(HaveKeyWithValue("integrity", "sha256-"+base64.StdEncoding.EncodeToString(sum[:])))
+					})
+				})
+			})
+
+			context("when the PNG is animated", func() {
+				it.Before(func() {
+					original = withPNGChunks(original, pngChunk("acTL", []byte{0, 0, 0, 1, 0, 0, 0, 0}))
+					Expect(os.WriteFile(filepath.Join(assetsDir, "logo-abc.png"), original, 0644)).To(Succeed())
+				})
+
+				it("leaves it alone", func() {
+					result, err := railsassets.OptimizeImages(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(result.Files).To(Equal(0))
+
+					Expect(os.ReadFile(filepath.Join(assetsDir, "logo-abc.png"))).To(Equal(original))
+				})
+			})
+		})
+
+		context("when there is a JPEG with metadata", func() {
+			var encoded []byte
+
+			it.Before(func() {
+				var buffer bytes.Buffer
+				Expect(jpeg.Encode(&buffer, picture, &jpeg.Options{Quality: 90})).To(Succeed())
+				encoded = buffer.Bytes()
+
+				Expect(os.WriteFile(filepath.Join(assetsDir, "photo-abc.jpg"), withJPEGSegments(encoded,
+					jpegSegment(0xE1, exif(1)),
+					jpegSegment(0xFE, []byte(strings.Repeat("comment", 20))),
+				), 0644)).To(Succeed())
+			})
+
+			it("strips the metadata and keeps the image data", func() {
+				result, err := railsassets.OptimizeImages(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Files).To(Equal(1))
+
+				Expect(os.ReadFile(filepath.Join(assetsDir, "photo-abc.jpg"))).To(Equal(encoded))
+			})
+
+			context("when the EXIF metadata rotates the image", func() {
+				var rotated []byte
+
+				it.Before(func() {
+					rotated = withJPEGSegments(encoded, jpegSegment(0xE1, exif(6)))
+					Expect(os.WriteFile(filepath.Join(assetsDir, "photo-abc.jpg"), withJPEGSegments(rotated,
+						jpegSegment(0xFE, []byte("comment")),
+					), 0644)).To(Succeed())
+				})
+
+				it("keeps it", func() {
+					_, err := railsassets.OptimizeImages(workingDir)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(os.ReadFile(filepath.Join(assetsDir, "photo-abc.jpg"))).To(Equal(rotated))
+				})
+			})
+		})
+
+		context("when there is a GIF with a comment", func() {
+			var encoded []byte
+
+			it.Before(func() {
+				paletted := image.NewPaletted(image.Rect(0, 0, 16, 16), color.Palette{color.Black, color.White})
+				for x := range 16 {
+					paletted.SetColorIndex(x, x, 1)
+				}
+
+				var buffer bytes.Buffer
+				Expect(gif.EncodeAll(&buffer, &gif.GIF{Image: []*image.Paletted{paletted}, Delay: []int{0}})).To(Succeed())
+				encoded = buffer.Bytes()
+
+				// The comment goes after the 13 byte header and the
+				// global colour table, when there is one.
+				var tableSize int
+				if encoded[10]&0x80 != 0 {
+					tableSize = 3 << ((encoded[10] & 0x07) + 1)
+				}
+				comment := append([]byte{0x21, 0xFE, 0xFF}, bytes.Repeat([]byte("c"), 255)...)
+				comment = append(comment, 0x00)
+
+				original := append([]byte{}, encoded[:13+tableSize]...)
+				original = append(original, comment...)
+				original = append(original, encoded[13+tableSize:]...)
+				Expect(os.WriteFile(filepath.Join(assetsDir, "spinner-abc.gif"), original, 0644)).To(Succeed())
+			})
+
+			it("re-encodes it", func() {
+				result, err := railsassets.OptimizeImages(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Files).To(Equal(1))
+
+				Expect(os.ReadFile(filepath.Join(assetsDir, "spinner-abc.gif"))).To(Equal(encoded))
+			})
+		})
+
+		context("when an image cannot be decoded", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(assetsDir, "broken-abc.png"), []byte("not an image"), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(assetsDir, "broken-abc.jpg"), []byte("not an image"), 0644)).To(Succeed())
+			})
+
+			it("leaves it alone", func() {
+				result, err := railsassets.OptimizeImages(workingDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Files).To(Equal(0))
+
+				Expect(os.ReadFile(filepath.Join(assetsDir, "broken-abc.png"))).To(Equal([]byte("not an image")))
+			})
+		})
+	})
+}
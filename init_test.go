@@ -9,10 +9,26 @@ import (
 
 func TestUnitRails(t *testing.T) {
 	suite := spec.New("railsassets", spec.Report(report.Terminal{}))
+	suite("AssetBudgets", testAssetBudgets)
+	suite("AssetExport", testAssetExport)
+	suite("AssetManifest", testAssetManifest)
+	suite("AssetSummary", testAssetSummary)
 	suite("Build", testBuild)
 	suite("Detect", testDetect)
+	suite("DestinationDiscovery", testDestinationDiscovery)
 	suite("DirectorySetup", testDirectorySetup)
+	suite("EnvironmentPolicy", testEnvironmentPolicy)
+	suite("GemfileLockParser", testGemfileLockParser)
 	suite("GemfileParser", testGemfileParser)
+	suite("ImageOptimization", testImageOptimization)
+	suite("LayerLayout", testLayerLayout)
 	suite("PrecompileProcess", testPrecompileProcess)
+	suite("Precompress", testPrecompress)
+	suite("ProcessGroupExecutable", testProcessGroupExecutable)
+	suite("ResourceLimits", testResourceLimits)
+	suite("SourceDiscovery", testSourceDiscovery)
+	suite("SourceMaps", testSourceMaps)
+	suite("ViteConfig", testViteConfig)
+	suite("WebpackerConfig", testWebpackerConfig)
 	suite.Run(t)
 }
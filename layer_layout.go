@@ -0,0 +1,129 @@
+package railsassets
+
+import (
+	"path/filepath"
+	"slices"
+)
+
+// LayerLayout describes how the "assets" layer is organised: which
+// destination paths it holds, how they are linked into the working directory,
+// and which asset pipelines write to them. A cached layer can only be reused
+// when its layout matches the current one.
+type LayerLayout struct {
+	DestinationPaths []string
+	LinkMode         LinkMode
+	Pipelines        []string
+}
+
+// ResolveLayerLayout determines the layout of the "assets" layer for the
+// application in the working directory.
+func ResolveLayerLayout(workingDir string) (LayerLayout, error) {
+	paths, err := assetsDestinationPaths(workingDir)
+	if err != nil {
+		return LayerLayout{}, err
+	}
+
+	mode, err := ParseLinkMode()
+	if err != nil {
+		return LayerLayout{}, err
+	}
+
+	lock, err := NewGemfileLockParser().Parse(filepath.Join(workingDir, "Gemfile.lock"))
+	if err != nil {
+		return LayerLayout{}, err
+	}
+
+	pipelines, err := detectPipelines(workingDir, lock)
+	if err != nil {
+		return LayerLayout{}, err
+	}
+
+	return LayerLayout{
+		DestinationPaths: paths,
+		LinkMode:         mode,
+		Pipelines:        pipelines,
+	}, nil
+}
+
+// Metadata returns the layout in the form that is stored in the "assets"
+// layer metadata.
+func (l LayerLayout) Metadata() map[string]interface{} {
+	return map[string]interface{}{
+		"destination_paths": l.DestinationPaths,
+		"link_mode":         string(l.LinkMode),
+		"pipelines":         l.Pipelines,
+	}
+}
+
+// Matches reports whether the layout recorded in the metadata of a previous
+// build is the same as this layout. Layers built before the layout was
+// recorded only ever used absolute symlinks, and are assumed to match when
+// that is still the link mode and only the default destination paths are
+// configured. Their pipelines are unknown.
+func (l LayerLayout) Matches(metadata map[string]interface{}) bool {
+	recorded, ok := metadata["layout"].(map[string]interface{})
+	if !ok {
+		return l.LinkMode == LinkModeSymlink && slices.Equal(l.DestinationPaths, defaultDestinationPaths)
+	}
+
+	mode, _ := recorded["link_mode"].(string)
+
+	return mode == string(l.LinkMode) &&
+		slices.Equal(metadataStrings(recorded["destination_paths"]), l.DestinationPaths) &&
+		slices.Equal(metadataStrings(recorded["pipelines"]), l.Pipelines)
+}
+
+// metadataStrings converts a list read back from layer metadata, which is
+// decoded as []interface{}, into a []string.
+func metadataStrings(value interface{}) []string {
+	switch values := value.(type) {
+	case []string:
+		return values
+	case []interface{}:
+		var strs []string
+		for _, v := range values {
+			s, _ := v.(string)
+			strs = append(strs, s)
+		}
+		return strs
+	default:
+		return nil
+	}
+}
+
+// detectPipelines names the asset pipelines that the application uses, based
+// on the Gemfile.lock.
+func detectPipelines(workingDir string, lock GemfileLock) ([]string, error) {
+	pipelines := []string{}
+
+	for _, gem := range []struct{ name, pipeline string }{
+		{"sprockets-rails", "sprockets"},
+		{"propshaft", "propshaft"},
+		{"jsbundling-rails", "jsbundling"},
+		{"cssbundling-rails", "cssbundling"},
+	} {
+		if lock.Has(gem.name) {
+			pipelines = append(pipelines, gem.pipeline)
+		}
+	}
+
+	webpacker, ok, err := ParseWebpackerConfig(workingDir, lock)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		pipelines = append(pipelines, webpacker.Gem)
+	}
+
+	_, ok, err = ParseViteConfig(workingDir, lock)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		pipelines = append(pipelines, "vite")
+	}
+
+	return pipelines, nil
+}
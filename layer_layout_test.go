@@ -0,0 +1,119 @@
+package railsassets_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	railsassets "github.com/paketo-buildpacks/rails-assets"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testLayerLayout(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("ResolveLayerLayout", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    jsbundling-rails (1.3.0)\n    propshaft (0.9.0)\n    vite_rails (3.0.17)\n"), 0600)).To(Succeed())
+			t.Setenv("BP_RAILS_ASSETS_LINK_MODE", "copy")
+		})
+
+		it("resolves the destination paths, link mode and pipelines", func() {
+			layout, err := railsassets.ResolveLayerLayout(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(layout).To(Equal(railsassets.LayerLayout{
+				DestinationPaths: []string{"public/assets", "public/packs", "tmp/cache/assets", "public/vite"},
+				LinkMode:         railsassets.LinkModeCopy,
+				Pipelines:        []string{"propshaft", "jsbundling", "vite"},
+			}))
+		})
+	})
+
+	context("Matches", func() {
+		var layout railsassets.LayerLayout
+
+		it.Before(func() {
+			layout = railsassets.LayerLayout{
+				DestinationPaths: []string{"public/assets", "public/packs"},
+				LinkMode:         railsassets.LinkModeSymlink,
+				Pipelines:        []string{"sprockets"},
+			}
+		})
+
+		it("matches the layout read back from the layer metadata", func() {
+			Expect(layout.Matches(map[string]interface{}{
+				"layout": map[string]interface{}{
+					"destination_paths": []interface{}{"public/assets", "public/packs"},
+					"link_mode":         "symlink",
+					"pipelines":         []interface{}{"sprockets"},
+				},
+			})).To(BeTrue())
+		})
+
+		it("does not match a layout with different destination paths", func() {
+			Expect(layout.Matches(map[string]interface{}{
+				"layout": map[string]interface{}{
+					"destination_paths": []interface{}{"public/assets"},
+					"link_mode":         "symlink",
+					"pipelines":         []interface{}{"sprockets"},
+				},
+			})).To(BeFalse())
+		})
+
+		it("does not match a layout with a different link mode", func() {
+			Expect(layout.Matches(map[string]interface{}{
+				"layout": map[string]interface{}{
+					"destination_paths": []interface{}{"public/assets", "public/packs"},
+					"link_mode":         "copy",
+					"pipelines":         []interface{}{"sprockets"},
+				},
+			})).To(BeFalse())
+		})
+
+		it("does not match a layout with different pipelines", func() {
+			Expect(layout.Matches(map[string]interface{}{
+				"layout": map[string]interface{}{
+					"destination_paths": []interface{}{"public/assets", "public/packs"},
+					"link_mode":         "symlink",
+					"pipelines":         []interface{}{"propshaft"},
+				},
+			})).To(BeFalse())
+		})
+
+		context("when no layout was recorded", func() {
+			it.Before(func() {
+				layout.DestinationPaths = []string{"public/assets", "public/packs", "tmp/cache/assets"}
+			})
+
+			it("matches when the link mode is symlink", func() {
+				Expect(layout.Matches(map[string]interface{}{})).To(BeTrue())
+			})
+
+			it("does not match any other link mode", func() {
+				layout.LinkMode = railsassets.LinkModeCopy
+				Expect(layout.Matches(map[string]interface{}{})).To(BeFalse())
+			})
+
+			it("does not match when there are other destination paths", func() {
+				layout.DestinationPaths = append(layout.DestinationPaths, "public/widgets")
+				Expect(layout.Matches(map[string]interface{}{})).To(BeFalse())
+			})
+		})
+	})
+}
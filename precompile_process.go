@@ -2,57 +2,448 @@ package railsassets
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/paketo-buildpacks/packit/v2/chronos"
 	"github.com/paketo-buildpacks/packit/v2/pexec"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/paketo-buildpacks/packit/v2/servicebindings"
 )
 
+// BindingTypes are the service binding types whose entries are exposed to the
+// "rails assets:precompile" build process as environment variables.
+var BindingTypes = []string{"rails-assets", "rails-credentials"}
+
 //go:generate faux --interface Executable --output fakes/executable.go
+//go:generate faux --interface BindingResolver --output fakes/binding_resolver.go
 
 // Executable defines the interface for executing a program as a child process.
 type Executable interface {
 	Execute(pexec.Execution) error
 }
 
+// BindingResolver defines the interface for resolving the service bindings
+// provided by the platform.
+type BindingResolver interface {
+	Resolve(typ, provider, platformDir string) ([]servicebindings.Binding, error)
+}
+
 // PrecompileProcess performs the "rails assets:precompile" build process.
 type PrecompileProcess struct {
-	executable Executable
-	logger     scribe.Emitter
+	executable      Executable
+	bindingResolver BindingResolver
+	logger          scribe.Emitter
+	clock           chronos.Clock
+	cgroupRoot      string
 }
 
 // NewPrecompileProcess initializes an instance of PrecompileProcess.
-func NewPrecompileProcess(executable Executable, logger scribe.Emitter) PrecompileProcess {
+func NewPrecompileProcess(executable Executable, bindingResolver BindingResolver, logger scribe.Emitter, clock chronos.Clock) PrecompileProcess {
 	return PrecompileProcess{
-		executable: executable,
-		logger:     logger,
+		executable:      executable,
+		bindingResolver: bindingResolver,
+		logger:          logger,
+		clock:           clock,
+		cgroupRoot:      DefaultCgroupRoot,
 	}
 }
 
+// WithCgroupRoot returns a copy of the process that reads the resource limits
+// of the build container from the cgroup filesystem mounted at the given
+// path.
+func (p PrecompileProcess) WithCgroupRoot(root string) PrecompileProcess {
+	p.cgroupRoot = root
+	return p
+}
+
 // Execute runs "bundle exec rails assets:precompile assets:clean" as a child
-// process. If the process fails, the error message will include the entire
-// output of the child process.
-func (p PrecompileProcess) Execute(workingDir string) error {
-	buffer := bytes.NewBuffer(nil)
+// process. Its output is streamed to the build log. If the process fails, the
+// error message will include the last lines of the output. If the process is
+// terminated because it exceeded $BP_RAILS_ASSETS_TIMEOUT, the error message
+// will say so.
+//
+// The environment of the child process is the buildpack environment filtered
+// by the EnvironmentPolicy. The entries of any "rails-assets" or
+// "rails-credentials" service bindings (e.g. RAILS_MASTER_KEY) are added to
+// the environment of the child process only. Their values are never logged or
+// written to a layer.
+//
+// The commands in $BP_RAILS_ASSETS_PRE_COMMANDS and
+// $BP_RAILS_ASSETS_POST_COMMANDS are run before and after the precompile
+// step respectively, with the same environment.
+//
+// Applications that use Webpacker or Shakapacker are compiled with
+// NODE_ENV=production unless NODE_ENV is already set.
+//
+// NODE_OPTIONS and MALLOC_ARENA_MAX are tuned to the memory limit of the
+// build container, and for Sprockets applications
+// RAILS_ASSETS_EXPORT_CONCURRENCY to its CPU limit, unless the user has
+// already set them.
+//
+// When $BP_RAILS_ASSETS_NO_DATABASE is true, DATABASE_URL points at a database
+// that needs no server so that initializers cannot reach a real database.
+func (p PrecompileProcess) Execute(workingDir, platformDir string) error {
 	args := []string{"exec", "rails", "assets:precompile", "assets:clean"}
 
+	lock, err := NewGemfileLockParser().Parse(filepath.Join(workingDir, "Gemfile.lock"))
+	if err != nil {
+		return err
+	}
+
+	secrets, err := p.resolveBindingSecrets(platformDir)
+	if err != nil {
+		return err
+	}
+
+	policy, err := NewEnvironmentPolicy(os.Getenv("BP_RAILS_ASSETS_ENV_ALLOWLIST"), os.Getenv("BP_RAILS_ASSETS_ENV_DENYLIST"))
+	if err != nil {
+		return err
+	}
+
+	env, err := processPrecompileEnv(mergeEnv(policy.Filter(os.Environ()), secrets), lock)
+	if err != nil {
+		return err
+	}
+
+	_, usesWebpacker, err := ParseWebpackerConfig(workingDir, lock)
+	if err != nil {
+		return err
+	}
+
+	if usesWebpacker && envValue(env, "NODE_ENV") == "" {
+		env = mergeEnv(env, map[string]string{"NODE_ENV": "production"})
+	}
+
+	noDatabase, err := parseBoolEnv("BP_RAILS_ASSETS_NO_DATABASE")
+	if err != nil {
+		return err
+	}
+
+	if noDatabase {
+		databaseURL, ok, err := nullDatabaseURL(workingDir, lock)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			p.logger.Subprocess("Using DATABASE_URL=%s to prevent database connections", databaseURL)
+			env = mergeEnv(env, map[string]string{"DATABASE_URL": databaseURL})
+		} else {
+			p.logger.Subprocess("Warning: BP_RAILS_ASSETS_NO_DATABASE is set but neither the activerecord-nulldb-adapter gem is in the Gemfile.lock nor the sqlite3 gem is in the default group of the Gemfile")
+		}
+	}
+
+	// An unreadable cgroup filesystem only means that the precompile is not
+	// tuned, so it does not fail the build.
+	limits, err := ReadResourceLimits(p.cgroupRoot)
+	if err != nil {
+		p.logger.Debug.Subprocess("Unable to read the resource limits: %s", err)
+		limits = ResourceLimits{CPUs: float64(runtime.NumCPU())}
+	}
+
+	p.logger.Debug.Subprocess("Resource limits: %s", limits)
+	tuned := resourceLimitedEnv(env, limits, lock.Has("sprockets"))
+	for _, name := range environmentNames(mapToEnv(tuned)) {
+		p.logger.Subprocess("Setting %s=%s to match the resource limits", name, tuned[name])
+	}
+	env = mergeEnv(env, tuned)
+
+	p.logger.Debug.Subprocess("Passing the following environment variables:")
+	for _, name := range environmentNames(env) {
+		p.logger.Debug.Action(name)
+	}
+
+	if command := hookCommand("BP_RAILS_ASSETS_PRE_COMMANDS"); command != "" {
+		err = p.runHook("pre-precompile", command, env)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The output is streamed to the build log as it is produced, and is also
+	// kept so that failures can be diagnosed once the process has exited.
+	output := bytes.NewBuffer(nil)
+
 	p.logger.Subprocess("Running 'bundle %s'", strings.Join(args, " "))
-	err := p.executable.Execute(pexec.Execution{
+	err = p.executable.Execute(pexec.Execution{
 		Args:   args,
-		Stdout: p.logger.ActionWriter,
-		Stderr: p.logger.ActionWriter,
-		Env:    processPrecompileEnv(os.Environ()),
+		Stdout: io.MultiWriter(p.logger.ActionWriter, output),
+		Stderr: io.MultiWriter(p.logger.ActionWriter, output),
+		Env:    env,
+	})
+	if err != nil {
+		var timeoutErr TimeoutError
+		if errors.As(err, &timeoutErr) {
+			return fmt.Errorf("assets build timed out after %s and was terminated; increase $BP_RAILS_ASSETS_TIMEOUT if the build needs more time: %w", timeoutErr.Timeout, err)
+		}
+
+		tail := outputTail(output.String(), precompileOutputTailLines)
+		if isOutOfMemoryError(err, output.String()) {
+			return fmt.Errorf("failed to execute bundle exec output:\n%s\nerror: %s\nthe precompile process probably ran out of memory (%s, NODE_OPTIONS=%q); give the build more memory or lower the heap size with NODE_OPTIONS=--max-old-space-size", tail, err, limits, envValue(env, "NODE_OPTIONS"))
+		}
+
+		if isDatabaseConnectionError(output.String()) {
+			hint := "set $BP_RAILS_ASSETS_NO_DATABASE=true to give the build a database that needs no server"
+			if noDatabase {
+				hint = "an initializer still connects to the database even though $BP_RAILS_ASSETS_NO_DATABASE is set; guard it so that it does not run during assets:precompile"
+			}
+
+			return fmt.Errorf("failed to execute bundle exec output:\n%s\nerror: %s\nthe precompile process tried to connect to a database, which is not available at build time: %s", tail, err, hint)
+		}
+
+		return fmt.Errorf("failed to execute bundle exec output:\n%s\nerror: %s", tail, err)
+	}
+
+	if command := hookCommand("BP_RAILS_ASSETS_POST_COMMANDS"); command != "" {
+		err = p.runHook("post-precompile", command, env)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// precompileOutputTailLines is the number of lines of output that are repeated
+// in the error message when the precompile fails.
+const precompileOutputTailLines = 20
+
+// outputTail returns the last lines of the output of a process, noting how
+// many earlier lines were left out.
+func outputTail(output string, lines int) string {
+	all := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(all) <= lines {
+		return strings.Join(all, "\n")
+	}
+
+	return fmt.Sprintf("... (%d earlier lines are in the build log above)\n%s", len(all)-lines, strings.Join(all[len(all)-lines:], "\n"))
+}
+
+// runHook runs a user-provided command as "bundle exec sh -c <command>" with
+// the same environment as the precompile step.
+func (p PrecompileProcess) runHook(stage, command string, env []string) error {
+	p.logger.Subprocess("Running %s command '%s'", stage, command)
+	duration, err := p.clock.Measure(func() error {
+		return p.executable.Execute(pexec.Execution{
+			Args:   []string{"exec", "sh", "-c", command},
+			Stdout: p.logger.ActionWriter,
+			Stderr: p.logger.ActionWriter,
+			Env:    env,
+		})
 	})
 	if err != nil {
-		return fmt.Errorf("failed to execute bundle exec output:\n%s\nerror: %s", buffer.String(), err)
+		var timeoutErr TimeoutError
+		if errors.As(err, &timeoutErr) {
+			return fmt.Errorf("%s command '%s' timed out after %s and was terminated: %w", stage, command, timeoutErr.Timeout, err)
+		}
+
+		return fmt.Errorf("failed to execute %s command '%s': %w", stage, command, err)
 	}
 
+	p.logger.Action("Completed in %s", duration.Round(time.Millisecond))
+
 	return nil
 }
 
-func processPrecompileEnv(env []string) []string {
+// hookCommand returns the shell command in the named environment variable.
+// It is run by a single shell, which handles any ";", "&&" or quoting in it.
+func hookCommand(name string) string {
+	return strings.TrimSpace(os.Getenv(name))
+}
+
+// resolveBindingSecrets reads the entries of the supported service bindings.
+// Entries whose names are not valid environment variable names are skipped.
+func (p PrecompileProcess) resolveBindingSecrets(platformDir string) (map[string]string, error) {
+	nameRe := regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	secrets := map[string]string{}
+	for _, typ := range BindingTypes {
+		bindings, err := p.bindingResolver.Resolve(typ, "", platformDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %q service bindings: %w", typ, err)
+		}
+
+		for _, binding := range bindings {
+			var names []string
+			for name := range binding.Entries {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			p.logger.Subprocess("Using service binding '%s' of type '%s' for the precompile environment", binding.Name, typ)
+			for _, name := range names {
+				if !nameRe.MatchString(name) {
+					p.logger.Debug.Action("Skipping binding entry %q: not a valid environment variable name", name)
+					continue
+				}
+
+				value, err := binding.Entries[name].ReadString()
+				if err != nil {
+					return nil, fmt.Errorf("failed to read entry %q of service binding %q: %w", name, binding.Name, err)
+				}
+
+				secrets[name] = strings.TrimRight(value, "\r\n")
+			}
+		}
+	}
+
+	return secrets, nil
+}
+
+// mapToEnv converts a map of variables into "NAME=value" pairs.
+func mapToEnv(variables map[string]string) []string {
+	var env []string
+	for name, value := range variables {
+		env = append(env, fmt.Sprintf("%s=%s", name, value))
+	}
+
+	return env
+}
+
+// envValue returns the value of the named variable in env.
+func envValue(env []string, name string) string {
+	for _, pair := range env {
+		if value, ok := strings.CutPrefix(pair, name+"="); ok {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// mergeEnv returns env with every variable in overrides set, replacing any
+// existing value.
+func mergeEnv(env []string, overrides map[string]string) []string {
+	if len(overrides) == 0 {
+		return env
+	}
+
+	var merged []string
+	for _, pair := range env {
+		name, _, _ := strings.Cut(pair, "=")
+		if _, ok := overrides[name]; !ok {
+			merged = append(merged, pair)
+		}
+	}
+
+	var names []string
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		merged = append(merged, fmt.Sprintf("%s=%s", name, overrides[name]))
+	}
+
+	return merged
+}
+
+// isOutOfMemoryError returns true when the process was killed by the kernel
+// OOM killer (exit status 137 or SIGKILL) or when Node reports that it has
+// exhausted its heap.
+func isOutOfMemoryError(err error, output string) bool {
+	if strings.Contains(output, "JavaScript heap out of memory") {
+		return true
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if exitErr.ExitCode() == 137 {
+			return true
+		}
+
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() && status.Signal() == syscall.SIGKILL {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nullDatabaseURL returns a DATABASE_URL that lets Active Record boot without
+// a database server, based on the adapters available in the bundle. The
+// nulldb adapter is only ever added for this purpose, so it is preferred.
+// sqlite3 is only used when it is in the default group of the Gemfile, as it
+// is often limited to the development and test groups, which $BUNDLE_WITHOUT
+// leaves out of the build.
+func nullDatabaseURL(workingDir string, lock GemfileLock) (string, bool, error) {
+	if lock.Has("activerecord-nulldb-adapter") {
+		return "nulldb://nohost", true, nil
+	}
+
+	if lock.Has("sqlite3") {
+		inDefault, err := NewGemfileParser().InDefaultGroup(filepath.Join(workingDir, "Gemfile"), "sqlite3")
+		if err != nil {
+			return "", false, err
+		}
+
+		if inDefault {
+			return "sqlite3::memory:", true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+// isDatabaseConnectionError returns true when the output contains one of the
+// errors raised by the common database adapters when they fail to connect.
+func isDatabaseConnectionError(output string) bool {
+	for _, message := range []string{
+		"ActiveRecord::ConnectionNotEstablished",
+		"ActiveRecord::NoDatabaseError",
+		"ActiveRecord::DatabaseConnectionError",
+		"PG::ConnectionBad",
+		"Mysql2::Error::ConnectionError",
+		"Trilogy::ConnectionError",
+		"could not connect to server",
+		"Can't connect to MySQL server",
+		"Can't connect to local MySQL server",
+	} {
+		if strings.Contains(output, message) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseBoolEnv parses the named environment variable as a boolean. An unset
+// variable is false.
+func parseBoolEnv(name string) (bool, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return false, nil
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+
+	return enabled, nil
+}
+
+// processPrecompileEnv ensures that the child process has a RAILS_ENV and a
+// secret key base. Rails 7.1 and later understand SECRET_KEY_BASE_DUMMY, which
+// tells them to generate a throwaway secret themselves. Older versions are
+// given a randomly generated secret that only ever exists in the environment
+// of the child process.
+func processPrecompileEnv(env []string, lock GemfileLock) ([]string, error) {
 	hasRailsEnv := false
 	hasSecretKeyBase := false
 	for _, pair := range env {
@@ -60,7 +451,7 @@ func processPrecompileEnv(env []string) []string {
 			hasRailsEnv = true
 		}
 
-		if strings.HasPrefix(pair, "SECRET_KEY_BASE=") {
+		if strings.HasPrefix(pair, "SECRET_KEY_BASE=") || strings.HasPrefix(pair, "SECRET_KEY_BASE_DUMMY=") {
 			hasSecretKeyBase = true
 		}
 	}
@@ -70,8 +461,18 @@ func processPrecompileEnv(env []string) []string {
 	}
 
 	if !hasSecretKeyBase {
-		env = append(env, "SECRET_KEY_BASE=dummy")
+		if lock.RailsVersionAtLeast(7, 1) {
+			env = append(env, "SECRET_KEY_BASE_DUMMY=1")
+		} else {
+			secret := make([]byte, 64)
+			_, err := rand.Read(secret)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate secret key base: %w", err)
+			}
+
+			env = append(env, fmt.Sprintf("SECRET_KEY_BASE=%s", hex.EncodeToString(secret)))
+		}
 	}
 
-	return env
+	return env, nil
 }
@@ -3,11 +3,18 @@ package railsassets_test
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/paketo-buildpacks/packit/v2/chronos"
 	"github.com/paketo-buildpacks/packit/v2/pexec"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/paketo-buildpacks/packit/v2/servicebindings"
 	railsassets "github.com/paketo-buildpacks/rails-assets"
 	"github.com/paketo-buildpacks/rails-assets/fakes"
 	"github.com/sclevine/spec"
@@ -21,9 +28,13 @@ func testPrecompileProcess(t *testing.T, context spec.G, it spec.S) {
 	context("Execute", func() {
 		var (
 			workingDir string
+			cgroupRoot string
+			buffer     *bytes.Buffer
 			executions []pexec.Execution
 			executable *fakes.Executable
 
+			bindingResolver *fakes.BindingResolver
+
 			precompileProcess railsassets.PrecompileProcess
 		)
 
@@ -32,6 +43,9 @@ func testPrecompileProcess(t *testing.T, context spec.G, it spec.S) {
 			workingDir, err = os.MkdirTemp("", "working-dir")
 			Expect(err).NotTo(HaveOccurred())
 
+			cgroupRoot, err = os.MkdirTemp("", "cgroup")
+			Expect(err).NotTo(HaveOccurred())
+
 			executions = []pexec.Execution{}
 			executable = &fakes.Executable{}
 			executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
@@ -40,26 +54,437 @@ func testPrecompileProcess(t *testing.T, context spec.G, it spec.S) {
 				return nil
 			}
 
-			logger := scribe.NewEmitter(bytes.NewBuffer(nil))
+			bindingResolver = &fakes.BindingResolver{}
+
+			buffer = bytes.NewBuffer(nil)
+			logger := scribe.NewEmitter(buffer)
 
-			precompileProcess = railsassets.NewPrecompileProcess(executable, logger)
+			precompileProcess = railsassets.NewPrecompileProcess(executable, bindingResolver, logger, chronos.DefaultClock).WithCgroupRoot(cgroupRoot)
 		})
 
 		it.After(func() {
 			Expect(os.RemoveAll(workingDir)).To(Succeed())
+			Expect(os.RemoveAll(cgroupRoot)).To(Succeed())
 		})
 
 		it("runs the bundle exec assets:precompile process", func() {
-			err := precompileProcess.Execute(workingDir)
+			err := precompileProcess.Execute(workingDir, "some-platform-dir")
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(executions).To(HaveLen(1))
 			Expect(executions[0].Args).To(Equal([]string{"exec", "rails", "assets:precompile", "assets:clean"}))
 			Expect(executions[0].Env).To(ContainElement("RAILS_ENV=production"))
-			Expect(executions[0].Env).To(ContainElement("SECRET_KEY_BASE=dummy"))
+			Expect(executions[0].Env).To(ContainElement(MatchRegexp(`^SECRET_KEY_BASE=[0-9a-f]{128}$`)))
+			Expect(executions[0].Env).NotTo(ContainElement(HavePrefix("SECRET_KEY_BASE_DUMMY=")))
+		})
+
+		context("when there are rails-assets or rails-credentials service bindings", func() {
+			it.Before(func() {
+				t.Setenv("RAILS_MASTER_KEY", "some-platform-value")
+
+				bindingResolver.ResolveCall.Stub = func(typ, provider, platformDir string) ([]servicebindings.Binding, error) {
+					switch typ {
+					case "rails-assets":
+						return []servicebindings.Binding{
+							{
+								Name: "some-assets-binding",
+								Type: "rails-assets",
+								Entries: map[string]*servicebindings.Entry{
+									"SENTRY_AUTH_TOKEN": servicebindings.NewWithValue([]byte("some-sentry-token")),
+									"not.a.variable":    servicebindings.NewWithValue([]byte("some-value")),
+								},
+							},
+						}, nil
+					case "rails-credentials":
+						return []servicebindings.Binding{
+							{
+								Name: "some-credentials-binding",
+								Type: "rails-credentials",
+								Entries: map[string]*servicebindings.Entry{
+									"RAILS_MASTER_KEY": servicebindings.NewWithValue([]byte("some-master-key\n")),
+								},
+							},
+						}, nil
+					}
+
+					return nil, nil
+				}
+			})
+
+			it("exposes the binding entries to the child process only", func() {
+				err := precompileProcess.Execute(workingDir, "some-platform-dir")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(bindingResolver.ResolveCall.CallCount).To(Equal(2))
+				Expect(bindingResolver.ResolveCall.Receives.PlatformDir).To(Equal("some-platform-dir"))
+
+				Expect(executions).To(HaveLen(1))
+				Expect(executions[0].Env).To(ContainElement("SENTRY_AUTH_TOKEN=some-sentry-token"))
+				Expect(executions[0].Env).To(ContainElement("RAILS_MASTER_KEY=some-master-key"))
+				Expect(executions[0].Env).NotTo(ContainElement("RAILS_MASTER_KEY=some-platform-value"))
+				Expect(executions[0].Env).NotTo(ContainElement(HavePrefix("not.a.variable=")))
+
+				Expect(buffer.String()).To(ContainSubstring("Using service binding 'some-credentials-binding' of type 'rails-credentials'"))
+				Expect(buffer.String()).NotTo(ContainSubstring("some-master-key"))
+				Expect(buffer.String()).NotTo(ContainSubstring("some-sentry-token"))
+			})
+		})
+
+		context("when there is an environment policy", func() {
+			it.Before(func() {
+				t.Setenv("CNB_PLATFORM_API", "0.12")
+				t.Setenv("SOME_SECRET", "some-secret-value")
+				t.Setenv("BP_RAILS_ASSETS_ENV_DENYLIST", "SOME_*")
+
+				precompileProcess = railsassets.NewPrecompileProcess(executable, bindingResolver, scribe.NewEmitter(buffer).WithLevel("DEBUG"), chronos.DefaultClock).WithCgroupRoot(cgroupRoot)
+			})
+
+			it("filters the environment and lists the variable names without values", func() {
+				err := precompileProcess.Execute(workingDir, "some-platform-dir")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(executions).To(HaveLen(1))
+				Expect(executions[0].Env).NotTo(ContainElement(HavePrefix("CNB_PLATFORM_API=")))
+				Expect(executions[0].Env).NotTo(ContainElement(HavePrefix("SOME_SECRET=")))
+				Expect(executions[0].Env).To(ContainElement(HavePrefix("PATH=")))
+
+				Expect(buffer.String()).To(ContainSubstring("Passing the following environment variables:"))
+				Expect(buffer.String()).To(ContainSubstring("RAILS_ENV"))
+				Expect(buffer.String()).NotTo(ContainSubstring("SOME_SECRET"))
+				Expect(buffer.String()).NotTo(MatchRegexp(`SECRET_KEY_BASE=`))
+			})
+		})
+
+		context("when there are pre- and post-precompile commands", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_PRE_COMMANDS", "rails js:routes; echo 'a;b' > tmp/out ")
+				t.Setenv("BP_RAILS_ASSETS_POST_COMMANDS", "./bin/upload-manifest")
+			})
+
+			it("runs the commands around the precompile step with the same environment", func() {
+				err := precompileProcess.Execute(workingDir, "some-platform-dir")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(executions).To(HaveLen(3))
+				Expect(executions[0].Args).To(Equal([]string{"exec", "sh", "-c", "rails js:routes; echo 'a;b' > tmp/out"}))
+				Expect(executions[1].Args).To(Equal([]string{"exec", "rails", "assets:precompile", "assets:clean"}))
+				Expect(executions[2].Args).To(Equal([]string{"exec", "sh", "-c", "./bin/upload-manifest"}))
+
+				for _, execution := range executions {
+					Expect(execution.Env).To(Equal(executions[1].Env))
+				}
+
+				Expect(buffer.String()).To(ContainSubstring(`Running pre-precompile command 'rails js:routes; echo 'a;b' > tmp/out'`))
+				Expect(buffer.String()).To(ContainSubstring("Running post-precompile command './bin/upload-manifest'"))
+				Expect(buffer.String()).To(ContainSubstring("Completed in"))
+			})
+
+			context("when a pre-precompile command fails", func() {
+				it.Before(func() {
+					executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
+						executions = append(executions, execution)
+						return errors.New("exit status 1")
+					}
+				})
+
+				it("returns an error without running the precompile step", func() {
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
+					Expect(err).To(MatchError("failed to execute pre-precompile command 'rails js:routes; echo 'a;b' > tmp/out': exit status 1"))
+					Expect(executions).To(HaveLen(1))
+				})
+			})
+		})
+
+		context("when the build container has a memory limit", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(cgroupRoot, "memory.max"), []byte("4294967296\n"), 0600)).To(Succeed())
+			})
+
+			it("sizes the Node heap and Ruby arenas to fit", func() {
+				err := precompileProcess.Execute(workingDir, "some-platform-dir")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(executions).To(HaveLen(1))
+				Expect(executions[0].Env).To(ContainElement("NODE_OPTIONS=--max-old-space-size=3072"))
+				Expect(executions[0].Env).To(ContainElement("MALLOC_ARENA_MAX=2"))
+				Expect(buffer.String()).To(ContainSubstring("Setting NODE_OPTIONS=--max-old-space-size=3072 to match the resource limits"))
+			})
+
+			context("when the user has configured NODE_OPTIONS", func() {
+				it.Before(func() {
+					t.Setenv("NODE_OPTIONS", "--enable-source-maps")
+					t.Setenv("MALLOC_ARENA_MAX", "4")
+				})
+
+				it("adds the heap size to the user options", func() {
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(executions).To(HaveLen(1))
+					Expect(executions[0].Env).To(ContainElement("NODE_OPTIONS=--enable-source-maps --max-old-space-size=3072"))
+					Expect(executions[0].Env).To(ContainElement("MALLOC_ARENA_MAX=4"))
+				})
+			})
+
+			context("when the user has configured the heap size", func() {
+				it.Before(func() {
+					t.Setenv("NODE_OPTIONS", "--max-old-space-size=1024")
+				})
+
+				it("respects it", func() {
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(executions).To(HaveLen(1))
+					Expect(executions[0].Env).To(ContainElement("NODE_OPTIONS=--max-old-space-size=1024"))
+				})
+			})
+
+			context("when the process is killed by the OOM killer", func() {
+				it.Before(func() {
+					executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
+						return exec.Command("sh", "-c", "exit 137").Run()
+					}
+				})
+
+				it("reports a probable out of memory error with the limits", func() {
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
+					Expect(err).To(MatchError(ContainSubstring("the precompile process probably ran out of memory (memory=4096 MiB")))
+					Expect(err).To(MatchError(ContainSubstring(`NODE_OPTIONS="--max-old-space-size=3072"`)))
+				})
+			})
+		})
+
+		context("when the build container has a CPU limit and the app uses Sprockets", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    sprockets (4.2.1)\n    sprockets-rails (3.5.2)\n"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(cgroupRoot, "cpu.max"), []byte("50000 100000\n"), 0600)).To(Succeed())
+
+				t.Setenv("RUBYOPT", "-W0")
+			})
+
+			it("sets the export concurrency without patching Ruby", func() {
+				err := precompileProcess.Execute(workingDir, "some-platform-dir")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(executions).To(HaveLen(1))
+				Expect(executions[0].Env).To(ContainElement("RAILS_ASSETS_EXPORT_CONCURRENCY=1"))
+				Expect(executions[0].Env).To(ContainElement("RUBYOPT=-W0"))
+				Expect(buffer.String()).To(ContainSubstring("Setting RAILS_ASSETS_EXPORT_CONCURRENCY=1 to match the resource limits"))
+			})
+
+			context("when the user has configured the export concurrency", func() {
+				it.Before(func() {
+					t.Setenv("RAILS_ASSETS_EXPORT_CONCURRENCY", "3")
+				})
+
+				it("respects it", func() {
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(executions).To(HaveLen(1))
+					Expect(executions[0].Env).To(ContainElement("RAILS_ASSETS_EXPORT_CONCURRENCY=3"))
+				})
+			})
+		})
+
+		context("when the resource limits cannot be read", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(cgroupRoot, "memory.max"), []byte("lots\n"), 0600)).To(Succeed())
+			})
+
+			it("runs without tuning the environment", func() {
+				err := precompileProcess.Execute(workingDir, "some-platform-dir")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(executions).To(HaveLen(1))
+				Expect(executions[0].Env).NotTo(ContainElement(HavePrefix("MALLOC_ARENA_MAX=")))
+				Expect(buffer.String()).NotTo(ContainSubstring("to match the resource limits"))
+			})
+		})
+
+		context("when the app uses jsbundling-rails or cssbundling-rails", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    cssbundling-rails (1.4.0)\n"), 0600)).To(Succeed())
+
+				buildsDir := filepath.Join(workingDir, "app", "assets", "builds")
+				Expect(os.MkdirAll(buildsDir, os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(buildsDir, ".keep"), []byte(""), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(buildsDir, "application.css"), []byte("body {}"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(buildsDir, "application.css.map"), []byte("{}"), 0600)).To(Succeed())
+			})
+
+			it("leaves the generated output in app/assets/builds for verification", func() {
+				err := precompileProcess.Execute(workingDir, "some-platform-dir")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filepath.Join(workingDir, "app", "assets", "builds", "application.css")).To(BeAnExistingFile())
+				Expect(filepath.Join(workingDir, "app", "assets", "builds", "application.css.map")).To(BeAnExistingFile())
+			})
 		})
 
-	        context("when a user sets their own RAILS_ENV", func() {
+		context("when the app uses shakapacker", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    shakapacker (7.2.0)\n"), 0600)).To(Succeed())
+
+				executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
+					executions = append(executions, execution)
+
+					Expect(os.MkdirAll(filepath.Join(workingDir, "public", "packs"), os.ModePerm)).To(Succeed())
+					return os.WriteFile(filepath.Join(workingDir, "public", "packs", "manifest.json"), []byte("{}"), 0600)
+				}
+			})
+
+			it("compiles with NODE_ENV=production", func() {
+				err := precompileProcess.Execute(workingDir, "some-platform-dir")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(executions).To(HaveLen(1))
+				Expect(executions[0].Env).To(ContainElement("NODE_ENV=production"))
+			})
+
+			context("when the user has set NODE_ENV", func() {
+				it.Before(func() {
+					t.Setenv("NODE_ENV", "staging")
+				})
+
+				it("respects it", func() {
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(executions[0].Env).To(ContainElement("NODE_ENV=staging"))
+					Expect(executions[0].Env).NotTo(ContainElement("NODE_ENV=production"))
+				})
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_NO_DATABASE is true", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_NO_DATABASE", "true")
+				t.Setenv("DATABASE_URL", "postgres://db.example.com/app")
+			})
+
+			context("when sqlite3 is in the default group", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile"), []byte("gem \"rails\"\ngem \"sqlite3\"\n"), 0600)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte(`GEM
+  specs:
+    sqlite3 (1.7.2)
+`), 0600)).To(Succeed())
+				})
+
+				it("uses an in-memory sqlite database", func() {
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(executions).To(HaveLen(1))
+					Expect(executions[0].Env).To(ContainElement("DATABASE_URL=sqlite3::memory:"))
+					Expect(executions[0].Env).NotTo(ContainElement("DATABASE_URL=postgres://db.example.com/app"))
+				})
+			})
+
+			context("when sqlite3 is only in the development and test groups", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile"), []byte("gem \"rails\"\ngem \"pg\"\n\ngroup :development, :test do\n  gem \"sqlite3\"\nend\n"), 0600)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte(`GEM
+  specs:
+    pg (1.5.4)
+    sqlite3 (1.7.2)
+`), 0600)).To(Succeed())
+				})
+
+				it("leaves DATABASE_URL alone and warns", func() {
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(executions).To(HaveLen(1))
+					Expect(executions[0].Env).To(ContainElement("DATABASE_URL=postgres://db.example.com/app"))
+					Expect(buffer.String()).To(ContainSubstring("Warning: BP_RAILS_ASSETS_NO_DATABASE is set"))
+				})
+			})
+
+			context("when activerecord-nulldb-adapter is in the bundle", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile"), []byte("gem \"rails\"\ngem \"sqlite3\"\ngem \"activerecord-nulldb-adapter\"\n"), 0600)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte(`GEM
+  specs:
+    activerecord-nulldb-adapter (1.0.1)
+    sqlite3 (1.7.2)
+`), 0600)).To(Succeed())
+				})
+
+				it("prefers the nulldb adapter", func() {
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(executions).To(HaveLen(1))
+					Expect(executions[0].Env).To(ContainElement("DATABASE_URL=nulldb://nohost"))
+				})
+			})
+
+			context("when no local adapter is in the bundle", func() {
+				it("leaves DATABASE_URL alone and warns", func() {
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(executions).To(HaveLen(1))
+					Expect(executions[0].Env).To(ContainElement("DATABASE_URL=postgres://db.example.com/app"))
+					Expect(buffer.String()).To(ContainSubstring("Warning: BP_RAILS_ASSETS_NO_DATABASE is set"))
+				})
+			})
+		})
+
+		context("when the app uses Rails 7.1 or later", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte(`GEM
+  remote: https://rubygems.org/
+  specs:
+    rails (7.1.3.2)
+      railties (= 7.1.3.2)
+`), 0600)).To(Succeed())
+			})
+
+			it("sets SECRET_KEY_BASE_DUMMY instead of a secret", func() {
+				err := precompileProcess.Execute(workingDir, "some-platform-dir")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(executions).To(HaveLen(1))
+				Expect(executions[0].Env).To(ContainElement("SECRET_KEY_BASE_DUMMY=1"))
+				Expect(executions[0].Env).NotTo(ContainElement(HavePrefix("SECRET_KEY_BASE=")))
+			})
+		})
+
+		context("when the app uses a Rails version before 7.1", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte(`GEM
+  remote: https://rubygems.org/
+  specs:
+    rails (7.0.8)
+      railties (= 7.0.8)
+`), 0600)).To(Succeed())
+			})
+
+			it("generates a different random secret for every build", func() {
+				Expect(precompileProcess.Execute(workingDir, "some-platform-dir")).To(Succeed())
+				Expect(precompileProcess.Execute(workingDir, "some-platform-dir")).To(Succeed())
+
+				Expect(executions).To(HaveLen(2))
+
+				var secrets []string
+				for _, execution := range executions {
+					for _, pair := range execution.Env {
+						if strings.HasPrefix(pair, "SECRET_KEY_BASE=") {
+							secrets = append(secrets, pair)
+						}
+					}
+				}
+				Expect(secrets).To(HaveLen(2))
+				Expect(secrets[0]).To(MatchRegexp(`^SECRET_KEY_BASE=[0-9a-f]{128}$`))
+				Expect(secrets[0]).NotTo(Equal(secrets[1]))
+			})
+		})
+
+		context("when a user sets their own RAILS_ENV", func() {
 			it.Before(func() {
 				Expect(os.Setenv("RAILS_ENV", "staging")).To(Succeed())
 			})
@@ -67,17 +492,17 @@ func testPrecompileProcess(t *testing.T, context spec.G, it spec.S) {
 				Expect(os.Unsetenv("RAILS_ENV")).To(Succeed())
 			})
 			it("runs the bundle exec assets:precompile process while respecting RAILS_ENV", func() {
-				err := precompileProcess.Execute(workingDir)
+				err := precompileProcess.Execute(workingDir, "some-platform-dir")
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(executions).To(HaveLen(1))
 				Expect(executions[0].Args).To(Equal([]string{"exec", "rails", "assets:precompile", "assets:clean"}))
 				Expect(executions[0].Env).To(ContainElement("RAILS_ENV=staging"))
-				Expect(executions[0].Env).To(ContainElement("SECRET_KEY_BASE=dummy"))
+				Expect(executions[0].Env).To(ContainElement(HavePrefix("SECRET_KEY_BASE=")))
 			})
 		})
 
-	        context("when a user sets their own SECRET_KEY_BASE", func() {
+		context("when a user sets their own SECRET_KEY_BASE", func() {
 			it.Before(func() {
 				Expect(os.Setenv("SECRET_KEY_BASE", "dummy2")).To(Succeed())
 			})
@@ -85,9 +510,9 @@ func testPrecompileProcess(t *testing.T, context spec.G, it spec.S) {
 				Expect(os.Unsetenv("SECRET_KEY_BASE")).To(Succeed())
 			})
 			it("runs the bundle exec assets:precompile process while respecting SECRET_KEY_BASE", func() {
-				err := precompileProcess.Execute(workingDir)
+				err := precompileProcess.Execute(workingDir, "some-platform-dir")
 				Expect(err).NotTo(HaveOccurred())
-	
+
 				Expect(executions).To(HaveLen(1))
 				Expect(executions[0].Args).To(Equal([]string{"exec", "rails", "assets:precompile", "assets:clean"}))
 				Expect(executions[0].Env).To(ContainElement("RAILS_ENV=production"))
@@ -103,10 +528,112 @@ func testPrecompileProcess(t *testing.T, context spec.G, it spec.S) {
 					}
 				})
 				it("prints the execution output and returns an error", func() {
-					err := precompileProcess.Execute(workingDir)
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
 					Expect(err).To(MatchError(ContainSubstring("failed to execute bundle exec")))
 					Expect(err).To(MatchError(ContainSubstring("bundle exec failed")))
 				})
+
+				context("when the process wrote output", func() {
+					it.Before(func() {
+						executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
+							for i := 1; i <= 30; i++ {
+								_, _ = fmt.Fprintf(execution.Stdout, "output line %d\n", i)
+							}
+							return errors.New("bundle exec failed")
+						}
+					})
+
+					it("includes the last lines of the output in the error", func() {
+						err := precompileProcess.Execute(workingDir, "some-platform-dir")
+						Expect(err).To(MatchError(ContainSubstring("output:\n... (10 earlier lines are in the build log above)\noutput line 11\n")))
+						Expect(err).To(MatchError(ContainSubstring("output line 30\nerror: bundle exec failed")))
+						Expect(err).NotTo(MatchError(ContainSubstring("output line 10\n")))
+					})
+				})
+			})
+
+			context("when the Gemfile.lock cannot be parsed", func() {
+				it.Before(func() {
+					Expect(os.Mkdir(filepath.Join(workingDir, "Gemfile.lock"), os.ModePerm)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
+					Expect(err).To(MatchError(ContainSubstring("failed to parse Gemfile.lock")))
+				})
+			})
+
+			context("when the service bindings cannot be resolved", func() {
+				it.Before(func() {
+					bindingResolver.ResolveCall.Returns.Error = errors.New("some-binding-error")
+				})
+
+				it("returns an error", func() {
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
+					Expect(err).To(MatchError(ContainSubstring(`failed to resolve "rails-assets" service bindings: some-binding-error`)))
+				})
+			})
+
+			context("when bundle exec fails to connect to a database", func() {
+				it.Before(func() {
+					executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
+						_, _ = fmt.Fprintln(execution.Stderr, "ActiveRecord::ConnectionNotEstablished: connection to server at \"127.0.0.1\", port 5432 failed")
+						return errors.New("exit status 1")
+					}
+				})
+
+				it("explains the failure", func() {
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
+					Expect(err).To(MatchError(ContainSubstring("the precompile process tried to connect to a database")))
+					Expect(err).To(MatchError(ContainSubstring("set $BP_RAILS_ASSETS_NO_DATABASE=true")))
+				})
+
+				context("when BP_RAILS_ASSETS_NO_DATABASE is already true", func() {
+					it.Before(func() {
+						t.Setenv("BP_RAILS_ASSETS_NO_DATABASE", "true")
+					})
+
+					it("explains that an initializer still connects", func() {
+						err := precompileProcess.Execute(workingDir, "some-platform-dir")
+						Expect(err).To(MatchError(ContainSubstring("an initializer still connects to the database")))
+					})
+				})
+			})
+
+			context("when BP_RAILS_ASSETS_NO_DATABASE cannot be parsed", func() {
+				it.Before(func() {
+					t.Setenv("BP_RAILS_ASSETS_NO_DATABASE", "maybe")
+				})
+
+				it("returns an error", func() {
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
+					Expect(err).To(MatchError(ContainSubstring("failed to parse BP_RAILS_ASSETS_NO_DATABASE")))
+				})
+			})
+
+			context("when the environment policy is invalid", func() {
+				it.Before(func() {
+					t.Setenv("BP_RAILS_ASSETS_ENV_ALLOWLIST", "[")
+				})
+
+				it("returns an error", func() {
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
+					Expect(err).To(MatchError(ContainSubstring("failed to parse BP_RAILS_ASSETS_ENV_ALLOWLIST")))
+				})
+			})
+
+			context("when bundle exec times out", func() {
+				it.Before(func() {
+					executable.ExecuteCall.Stub = func(execution pexec.Execution) error {
+						return railsassets.TimeoutError{Timeout: 5 * time.Minute}
+					}
+				})
+
+				it("returns an error that says the build timed out", func() {
+					err := precompileProcess.Execute(workingDir, "some-platform-dir")
+					Expect(err).To(MatchError(ContainSubstring("assets build timed out after 5m0s")))
+					Expect(err).To(MatchError(ContainSubstring("BP_RAILS_ASSETS_TIMEOUT")))
+				})
 			})
 		})
 	})
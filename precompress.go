@@ -0,0 +1,400 @@
+package railsassets
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// DefaultPrecompressMinSize is the size below which assets are not
+// precompressed, as the saving rarely outweighs the cost of serving a
+// separate file.
+const DefaultPrecompressMinSize = 1024
+
+// PrecompressFormat is a compression format that the buildpack writes
+// precompressed variants of assets in.
+type PrecompressFormat string
+
+const (
+	PrecompressGzip   PrecompressFormat = "gzip"
+	PrecompressBrotli PrecompressFormat = "brotli"
+)
+
+// Extension returns the extension that is appended to the name of an asset to
+// name its variant in the format.
+func (f PrecompressFormat) Extension() string {
+	if f == PrecompressBrotli {
+		return ".br"
+	}
+	return ".gz"
+}
+
+// PrecompressResult counts the variants that were written in each format.
+type PrecompressResult map[PrecompressFormat]int
+
+// ParsePrecompressFormats reads $BP_RAILS_ASSETS_PRECOMPRESS, which is either
+// a boolean or a comma-separated list of formats ("gzip" and "brotli"). "true"
+// enables both formats. No formats are returned when precompression is
+// disabled, which is the default.
+func ParsePrecompressFormats() ([]PrecompressFormat, error) {
+	enabled, err := parseBoolEnv("BP_RAILS_ASSETS_PRECOMPRESS")
+	if err == nil {
+		if !enabled {
+			return nil, nil
+		}
+		return []PrecompressFormat{PrecompressGzip, PrecompressBrotli}, nil
+	}
+
+	value := strings.TrimSpace(os.Getenv("BP_RAILS_ASSETS_PRECOMPRESS"))
+
+	var formats []PrecompressFormat
+	for _, name := range strings.Split(value, ",") {
+		format := PrecompressFormat(strings.TrimSpace(name))
+		if format != PrecompressGzip && format != PrecompressBrotli {
+			return nil, fmt.Errorf("invalid BP_RAILS_ASSETS_PRECOMPRESS %q: must be a boolean or a list of %q and %q", value, PrecompressGzip, PrecompressBrotli)
+		}
+
+		if !slices.Contains(formats, format) {
+			formats = append(formats, format)
+		}
+	}
+
+	return formats, nil
+}
+
+// ParsePrecompressMinSize reads $BP_RAILS_ASSETS_PRECOMPRESS_MIN_SIZE, a size
+// such as 1KB or 512, and defaults to DefaultPrecompressMinSize.
+func ParsePrecompressMinSize() (int64, error) {
+	value := os.Getenv("BP_RAILS_ASSETS_PRECOMPRESS_MIN_SIZE")
+	if value == "" {
+		return DefaultPrecompressMinSize, nil
+	}
+
+	size, err := parseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid BP_RAILS_ASSETS_PRECOMPRESS_MIN_SIZE: %w", err)
+	}
+
+	return size, nil
+}
+
+// PrecompressAssets walks the output directories of the asset pipelines that
+// the application uses and writes a variant of each compressible file in every
+// format, such as application-abc.js.gz next to application-abc.js. Files
+// smaller than minSize, files whose content type does not compress well, and
+// variants that already exist are skipped, and a variant is only kept when it
+// is smaller than the original. Files are compressed in parallel, one per CPU.
+func PrecompressAssets(workingDir string, formats []PrecompressFormat, minSize int64) (PrecompressResult, error) {
+	result := PrecompressResult{}
+	if len(formats) == 0 {
+		return result, nil
+	}
+
+	files, err := compiledFiles(workingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	type job struct {
+		path   string
+		format PrecompressFormat
+	}
+
+	var jobs []job
+	for _, path := range files {
+		if !isCompressible(path) {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if info.Size() < minSize {
+			continue
+		}
+
+		for _, format := range formats {
+			if exists(path + format.Extension()) {
+				continue
+			}
+			jobs = append(jobs, job{path: path, format: format})
+		}
+	}
+
+	var mutex sync.Mutex
+	err = inParallel(jobs, func(j job) error {
+		written, err := writeCompressedVariant(j.path, j.format)
+		if err != nil {
+			return err
+		}
+
+		if written {
+			mutex.Lock()
+			result[j.format]++
+			mutex.Unlock()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// inParallel calls fn with each of the items, using one goroutine per CPU
+// that the CPU limit of the build container allows, and returns the errors
+// that it returns.
+func inParallel[T any](items []T, fn func(T) error) error {
+	var (
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+		errs  []error
+	)
+
+	// An unreadable cgroup filesystem only means that every CPU of the host
+	// is used.
+	cpus := runtime.NumCPU()
+	if limits, err := ReadResourceLimits(DefaultCgroupRoot); err == nil {
+		cpus = max(int(limits.CPUs), 1)
+	}
+
+	queue := make(chan T)
+	for range min(cpus, max(len(items), 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range queue {
+				err := fn(item)
+				if err != nil {
+					mutex.Lock()
+					errs = append(errs, err)
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, item := range items {
+		queue <- item
+	}
+	close(queue)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// compiledFiles returns the paths, within the working directory, of the
+// regular files in the output directories of the asset pipelines, leaving out
+// their manifests and hidden files. The output directories are usually links
+// into the "assets" layer, which are followed.
+func compiledFiles(workingDir string) ([]string, error) {
+	lock, err := NewGemfileLockParser().Parse(filepath.Join(workingDir, "Gemfile.lock"))
+	if err != nil {
+		return nil, err
+	}
+
+	locations, _, err := findAssetManifests(workingDir, lock)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		files   []string
+		walked  = map[string]bool{}
+		seen    = map[string]bool{}
+		skipped = map[string]bool{}
+	)
+
+	for _, location := range locations {
+		manifest, err := filepath.EvalSymlinks(filepath.Join(workingDir, location.path))
+		if err != nil {
+			return nil, err
+		}
+		skipped[manifest] = true
+	}
+
+	for _, location := range locations {
+		output, err := filepath.EvalSymlinks(filepath.Join(workingDir, location.output))
+		if err != nil {
+			return nil, err
+		}
+
+		if walked[output] {
+			continue
+		}
+		walked[output] = true
+
+		err = filepath.WalkDir(output, func(path string, entry iofs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			// Manifests and other hidden files are not served.
+			if path != output && strings.HasPrefix(entry.Name(), ".") {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if !entry.Type().IsRegular() || skipped[path] || seen[path] {
+				return nil
+			}
+			seen[path] = true
+
+			rel, err := filepath.Rel(output, path)
+			if err != nil {
+				return err
+			}
+
+			files = append(files, filepath.Join(workingDir, location.output, rel))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	slices.Sort(files)
+	return files, nil
+}
+
+// contentTypes adds the types of files that asset pipelines commonly write
+// but that are missing from the system MIME tables.
+var contentTypes = map[string]string{
+	".eot":         "application/vnd.ms-fontobject",
+	".js":          "text/javascript",
+	".json":        "application/json",
+	".map":         "application/json",
+	".mjs":         "text/javascript",
+	".otf":         "font/otf",
+	".svg":         "image/svg+xml",
+	".ttf":         "font/ttf",
+	".txt":         "text/plain",
+	".wasm":        "application/wasm",
+	".webmanifest": "application/manifest+json",
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+}
+
+// contentType returns the MIME type of a file, based on its extension.
+func contentType(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if contentType, ok := contentTypes[ext]; ok {
+		return contentType
+	}
+
+	contentType := mime.TypeByExtension(ext)
+	if contentType == "" {
+		return "application/octet-stream"
+	}
+
+	contentType, _, _ = strings.Cut(contentType, ";")
+	return contentType
+}
+
+// isCompressible reports whether a file has a text content type, or another
+// content type that compresses well. WOFF fonts and most images are already
+// compressed.
+func isCompressible(path string) bool {
+	contentType := contentType(path)
+
+	return strings.HasPrefix(contentType, "text/") ||
+		slices.Contains([]string{
+			"application/javascript",
+			"application/json",
+			"application/manifest+json",
+			"application/vnd.ms-fontobject",
+			"application/wasm",
+			"application/xml",
+			"font/otf",
+			"font/ttf",
+			"image/svg+xml",
+			"image/x-icon",
+			"image/vnd.microsoft.icon",
+		}, contentType)
+}
+
+// writeCompressedVariant compresses a file in the format and writes the result
+// next to it, unless it is not smaller than the file itself. It reports
+// whether the variant was written.
+func writeCompressedVariant(path string, format PrecompressFormat) (bool, error) {
+	source, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	variant, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(variant.Name())
+	defer variant.Close()
+
+	var writer io.WriteCloser
+	if format == PrecompressBrotli {
+		writer = brotli.NewWriterLevel(variant, brotli.BestCompression)
+	} else {
+		writer, err = gzip.NewWriterLevel(variant, gzip.BestCompression)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err = io.Copy(writer, source)
+	if err != nil {
+		return false, fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return false, fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+
+	compressed, err := variant.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if compressed.Size() >= info.Size() {
+		return false, nil
+	}
+
+	err = variant.Chmod(info.Mode().Perm())
+	if err != nil {
+		return false, err
+	}
+
+	err = variant.Close()
+	if err != nil {
+		return false, err
+	}
+
+	err = os.Rename(variant.Name(), path+format.Extension())
+	if err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", path+format.Extension(), err)
+	}
+
+	return true, nil
+}
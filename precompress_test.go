@@ -0,0 +1,234 @@
+package railsassets_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	railsassets "github.com/paketo-buildpacks/rails-assets"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testPrecompress(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+		assetsDir  string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		assetsDir = filepath.Join(workingDir, "public", "assets")
+		Expect(os.MkdirAll(assetsDir, os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    propshaft (1.1.0)\n"), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(assetsDir, ".manifest.json"), []byte(`{"application.js": "application-abc.js"}`), 0600)).To(Succeed())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("ParsePrecompressFormats", func() {
+		it("returns no formats by default", func() {
+			formats, err := railsassets.ParsePrecompressFormats()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(formats).To(BeEmpty())
+		})
+
+		for _, value := range []string{"true", "1", "TRUE"} {
+			value := value
+
+			context(fmt.Sprintf("when BP_RAILS_ASSETS_PRECOMPRESS=%s", value), func() {
+				it.Before(func() {
+					t.Setenv("BP_RAILS_ASSETS_PRECOMPRESS", value)
+				})
+
+				it("returns both formats", func() {
+					formats, err := railsassets.ParsePrecompressFormats()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(formats).To(Equal([]railsassets.PrecompressFormat{railsassets.PrecompressGzip, railsassets.PrecompressBrotli}))
+				})
+			})
+		}
+
+		for _, value := range []string{"false", "0", "F"} {
+			value := value
+
+			context(fmt.Sprintf("when BP_RAILS_ASSETS_PRECOMPRESS=%s", value), func() {
+				it.Before(func() {
+					t.Setenv("BP_RAILS_ASSETS_PRECOMPRESS", value)
+				})
+
+				it("returns no formats", func() {
+					formats, err := railsassets.ParsePrecompressFormats()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(formats).To(BeEmpty())
+				})
+			})
+		}
+
+		context("when BP_RAILS_ASSETS_PRECOMPRESS lists formats", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_PRECOMPRESS", "brotli, brotli")
+			})
+
+			it("returns the listed formats", func() {
+				formats, err := railsassets.ParsePrecompressFormats()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(formats).To(Equal([]railsassets.PrecompressFormat{railsassets.PrecompressBrotli}))
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_PRECOMPRESS is invalid", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_PRECOMPRESS", "zstd")
+			})
+
+			it("returns an error", func() {
+				_, err := railsassets.ParsePrecompressFormats()
+				Expect(err).To(MatchError(`invalid BP_RAILS_ASSETS_PRECOMPRESS "zstd": must be a boolean or a list of "gzip" and "brotli"`))
+			})
+		})
+	})
+
+	context("ParsePrecompressMinSize", func() {
+		it("defaults to 1024 bytes", func() {
+			size, err := railsassets.ParsePrecompressMinSize()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(size).To(Equal(int64(1024)))
+		})
+
+		context("when BP_RAILS_ASSETS_PRECOMPRESS_MIN_SIZE is set", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_PRECOMPRESS_MIN_SIZE", "10KB")
+			})
+
+			it("returns the size", func() {
+				size, err := railsassets.ParsePrecompressMinSize()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).To(Equal(int64(10 * 1024)))
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_PRECOMPRESS_MIN_SIZE is invalid", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_PRECOMPRESS_MIN_SIZE", "small")
+			})
+
+			it("returns an error", func() {
+				_, err := railsassets.ParsePrecompressMinSize()
+				Expect(err).To(MatchError(`invalid BP_RAILS_ASSETS_PRECOMPRESS_MIN_SIZE: invalid size "small"`))
+			})
+		})
+	})
+
+	context("PrecompressAssets", func() {
+		var content []byte
+
+		it.Before(func() {
+			content = []byte(strings.Repeat("console.log('hello');\n", 100))
+
+			Expect(os.WriteFile(filepath.Join(assetsDir, "application-abc.js"), content, 0644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(assetsDir, "admin"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(assetsDir, "admin", "application-def.css"), []byte(strings.Repeat("body { color: red; }\n", 100)), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(assetsDir, "small-123.js"), []byte("x"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(assetsDir, "logo-456.png"), bytes.Repeat([]byte{0}, 4096), 0644)).To(Succeed())
+		})
+
+		it("writes gzip and brotli variants of the compressible files", func() {
+			result, err := railsassets.PrecompressAssets(workingDir, []railsassets.PrecompressFormat{railsassets.PrecompressGzip, railsassets.PrecompressBrotli}, 1024)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(railsassets.PrecompressResult{
+				railsassets.PrecompressGzip:   2,
+				railsassets.PrecompressBrotli: 2,
+			}))
+
+			file, err := os.Open(filepath.Join(assetsDir, "application-abc.js.gz"))
+			Expect(err).NotTo(HaveOccurred())
+			defer file.Close()
+
+			reader, err := gzip.NewReader(file)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(io.ReadAll(reader)).To(Equal(content))
+
+			compressed, err := os.ReadFile(filepath.Join(assetsDir, "application-abc.js.br"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(io.ReadAll(brotli.NewReader(bytes.NewReader(compressed)))).To(Equal(content))
+
+			info, err := os.Stat(filepath.Join(assetsDir, "application-abc.js.br"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0644)))
+
+			Expect(filepath.Join(assetsDir, "admin", "application-def.css.gz")).To(BeARegularFile())
+			Expect(filepath.Join(assetsDir, "admin", "application-def.css.br")).To(BeARegularFile())
+
+			Expect(filepath.Join(assetsDir, "small-123.js.gz")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(assetsDir, "logo-456.png.gz")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(assetsDir, ".manifest.json.gz")).NotTo(BeAnExistingFile())
+
+			entries, err := filepath.Glob(filepath.Join(assetsDir, "*.tmp"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		})
+
+		context("when a variant already exists", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(assetsDir, "application-abc.js.gz"), []byte("existing"), 0644)).To(Succeed())
+			})
+
+			it("leaves it as it is", func() {
+				result, err := railsassets.PrecompressAssets(workingDir, []railsassets.PrecompressFormat{railsassets.PrecompressGzip}, 1024)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(railsassets.PrecompressResult{railsassets.PrecompressGzip: 1}))
+
+				Expect(os.ReadFile(filepath.Join(assetsDir, "application-abc.js.gz"))).To(Equal([]byte("existing")))
+			})
+		})
+
+		context("when the output directory is a link", func() {
+			var layerDir string
+
+			it.Before(func() {
+				var err error
+				layerDir, err = os.MkdirTemp("", "layer")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(os.Rename(assetsDir, filepath.Join(layerDir, "public-assets"))).To(Succeed())
+				Expect(os.Symlink(filepath.Join(layerDir, "public-assets"), assetsDir)).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.RemoveAll(layerDir)).To(Succeed())
+			})
+
+			it("follows it", func() {
+				_, err := railsassets.PrecompressAssets(workingDir, []railsassets.PrecompressFormat{railsassets.PrecompressGzip}, 1024)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filepath.Join(layerDir, "public-assets", "application-abc.js.gz")).To(BeARegularFile())
+			})
+		})
+
+		context("when no formats are given", func() {
+			it("does nothing", func() {
+				result, err := railsassets.PrecompressAssets(workingDir, nil, 1024)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(BeEmpty())
+
+				Expect(filepath.Join(assetsDir, "application-abc.js.gz")).NotTo(BeAnExistingFile())
+			})
+		})
+	})
+}
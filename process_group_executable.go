@@ -0,0 +1,242 @@
+package railsassets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/paketo-buildpacks/packit/v2/pexec"
+)
+
+// DefaultTerminationGracePeriod is the amount of time a process group is
+// given to exit after receiving SIGTERM before it is sent SIGKILL.
+const DefaultTerminationGracePeriod = 10 * time.Second
+
+// TimeoutError is returned by ProcessGroupExecutable when the child process
+// did not complete within the configured timeout.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s", e.Timeout)
+}
+
+// ProcessGroupExecutable invokes an executable on the $PATH as the leader of
+// its own process group so that the executable and every child it spawns
+// (bundler, rake, node, etc.) can be terminated together.
+type ProcessGroupExecutable struct {
+	name        string
+	gracePeriod time.Duration
+}
+
+// NewProcessGroupExecutable initializes a ProcessGroupExecutable instance.
+func NewProcessGroupExecutable(name string) ProcessGroupExecutable {
+	return ProcessGroupExecutable{
+		name:        name,
+		gracePeriod: DefaultTerminationGracePeriod,
+	}
+}
+
+// WithGracePeriod returns a copy of the executable that waits the given
+// duration between sending SIGTERM and SIGKILL to the process group.
+func (e ProcessGroupExecutable) WithGracePeriod(gracePeriod time.Duration) ProcessGroupExecutable {
+	e.gracePeriod = gracePeriod
+	return e
+}
+
+// Execute invokes the executable with the given Execution arguments. If
+// $BP_RAILS_ASSETS_TIMEOUT is set and the process group has not exited once
+// it expires, the group is sent SIGTERM, followed by SIGKILL if any process in
+// it is still running after the grace period, and a TimeoutError is returned.
+// The timeout applies to each call, so every command run through the
+// executable gets the full duration. SIGTERM and SIGINT received by the
+// buildpack while the process is running are forwarded to the process group
+// in the same manner.
+func (e ProcessGroupExecutable) Execute(execution pexec.Execution) error {
+	timeout, err := parseTimeout(os.Getenv("BP_RAILS_ASSETS_TIMEOUT"))
+	if err != nil {
+		return err
+	}
+
+	path := e.name
+	if !strings.Contains(path, string(os.PathSeparator)) {
+		envPath := os.Getenv("PATH")
+		for _, variable := range execution.Env {
+			if strings.HasPrefix(variable, "PATH=") {
+				envPath = strings.TrimPrefix(variable, "PATH=")
+			}
+		}
+
+		path, err = lookPath(e.name, envPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.Command(path, execution.Args...)
+	cmd.Dir = execution.Dir
+	if len(execution.Env) > 0 {
+		cmd.Env = execution.Env
+	}
+	cmd.Stdout = execution.Stdout
+	cmd.Stderr = execution.Stderr
+	cmd.Stdin = execution.Stdin
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case err := <-done:
+		return err
+
+	case <-expired:
+		e.terminate(cmd.Process.Pid, done)
+		return TimeoutError{Timeout: timeout}
+
+	case sig := <-signals:
+		e.terminate(cmd.Process.Pid, done)
+		return fmt.Errorf("terminated by signal: %s", sig)
+	}
+}
+
+// terminate sends SIGTERM to the process group and waits for the group
+// leader and then every other process in the group to exit. Whatever is still
+// running once the grace period is over is sent SIGKILL.
+func (e ProcessGroupExecutable) terminate(pgid int, done <-chan error) {
+	_ = syscall.Kill(-pgid, syscall.SIGTERM)
+
+	timer := time.NewTimer(e.gracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		_ = syscall.Kill(-pgid, syscall.SIGKILL)
+		<-done
+		return
+	}
+
+	// The group leader may exit before the children it spawned, which are
+	// given the rest of the grace period to shut down.
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for processGroupRunning(pgid) {
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			_ = syscall.Kill(-pgid, syscall.SIGKILL)
+			return
+		}
+	}
+}
+
+// processGroupRunning returns true while any process in the group has not
+// exited. Zombies, which exited but have not been reaped by their new parent,
+// are not counted. When /proc cannot be read, any process in the group counts.
+func processGroupRunning(pgid int) bool {
+	if err := syscall.Kill(-pgid, 0); errors.Is(err, syscall.ESRCH) {
+		return false
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return true
+	}
+
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+
+		stat, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+
+		// The fields that follow the parenthesized command name are the state,
+		// the parent PID and the process group ID.
+		fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+		if len(fields) < 3 || fields[0] == "Z" {
+			continue
+		}
+
+		if fields[2] == strconv.Itoa(pgid) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookPath searches the directories in envPath, rather than the PATH of the
+// buildpack process, for an executable file with the given name.
+func lookPath(name, envPath string) (string, error) {
+	for _, dir := range filepath.SplitList(envPath) {
+		// Like exec.LookPath, relative entries such as "." are not searched.
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0 {
+			return path, nil
+		}
+	}
+
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// parseTimeout accepts either a Go duration string (e.g. "15m") or a plain
+// number of seconds. An empty value disables the timeout.
+func parseTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, fmt.Errorf("failed to parse BP_RAILS_ASSETS_TIMEOUT: %q must not be negative", value)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse BP_RAILS_ASSETS_TIMEOUT: %w", err)
+	}
+
+	if timeout < 0 {
+		return 0, errors.New("failed to parse BP_RAILS_ASSETS_TIMEOUT: duration must not be negative")
+	}
+
+	return timeout, nil
+}
@@ -0,0 +1,209 @@
+package railsassets_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/paketo-buildpacks/packit/v2/pexec"
+	railsassets "github.com/paketo-buildpacks/rails-assets"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testProcessGroupExecutable(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect     = NewWithT(t).Expect
+		Eventually = NewWithT(t).Eventually
+
+		workingDir string
+		executable railsassets.ProcessGroupExecutable
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		executable = railsassets.NewProcessGroupExecutable("sh").WithGracePeriod(100 * time.Millisecond)
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("Execute", func() {
+		it("runs the executable in the given directory", func() {
+			buffer := bytes.NewBuffer(nil)
+			err := executable.Execute(pexec.Execution{
+				Args:   []string{"-c", "pwd && echo $SOME_VAR"},
+				Dir:    workingDir,
+				Env:    append(os.Environ(), "SOME_VAR=some-value"),
+				Stdout: buffer,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			dir, err := filepath.EvalSymlinks(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.TrimSpace(buffer.String())).To(Equal(dir + "\nsome-value"))
+		})
+
+		context("when the execution has its own PATH", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "some-executable"), []byte("#!/bin/sh\necho from-env-path\n"), 0755)).To(Succeed())
+				executable = railsassets.NewProcessGroupExecutable("some-executable")
+			})
+
+			it("finds the executable there without changing the PATH of the process", func() {
+				path := os.Getenv("PATH")
+
+				buffer := bytes.NewBuffer(nil)
+				err := executable.Execute(pexec.Execution{
+					Env:    []string{"PATH=" + workingDir + string(os.PathListSeparator) + path},
+					Stdout: buffer,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(strings.TrimSpace(buffer.String())).To(Equal("from-env-path"))
+				Expect(os.Getenv("PATH")).To(Equal(path))
+			})
+		})
+
+		context("when $BP_RAILS_ASSETS_TIMEOUT expires", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_TIMEOUT", "200ms")
+			})
+
+			it("terminates the whole process group and returns a timeout error", func() {
+				pidFile := filepath.Join(workingDir, "child.pid")
+
+				start := time.Now()
+				err := executable.Execute(pexec.Execution{
+					Args: []string{"-c", "sleep 30 & echo $! > child.pid; wait"},
+					Dir:  workingDir,
+				})
+				Expect(err).To(MatchError(railsassets.TimeoutError{Timeout: 200 * time.Millisecond}))
+				Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+
+				content, err := os.ReadFile(pidFile)
+				Expect(err).NotTo(HaveOccurred())
+
+				// The orphaned child may linger as a zombie until it is reaped, which
+				// still counts as terminated.
+				Eventually(func() bool {
+					stat, err := os.ReadFile(filepath.Join("/proc", strings.TrimSpace(string(content)), "stat"))
+					if os.IsNotExist(err) {
+						return true
+					}
+					Expect(err).NotTo(HaveOccurred())
+
+					fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+					return fields[0] == "Z"
+				}).Should(BeTrue())
+			})
+
+			context("when the process ignores SIGTERM", func() {
+				it("kills the process group after the grace period", func() {
+					err := executable.Execute(pexec.Execution{
+						Args: []string{"-c", "trap '' TERM; sleep 30"},
+						Dir:  workingDir,
+					})
+					Expect(err).To(MatchError(ContainSubstring("timed out after 200ms")))
+				})
+			})
+
+			context("when children outlive the group leader", func() {
+				it.Before(func() {
+					t.Setenv("BP_RAILS_ASSETS_TIMEOUT", "500ms")
+					executable = executable.WithGracePeriod(5 * time.Second)
+				})
+
+				it("gives them the rest of the grace period", func() {
+					err := executable.Execute(pexec.Execution{
+						Args: []string{"-c", `
+(trap 'sleep 0.3; echo done > child.done; exit 0' TERM; while true; do sleep 0.05; done) &
+trap 'exit 0' TERM
+wait`},
+						Dir: workingDir,
+					})
+					Expect(err).To(MatchError(ContainSubstring("timed out after 500ms")))
+					Expect(filepath.Join(workingDir, "child.done")).To(BeARegularFile())
+				})
+			})
+		})
+
+		for _, sig := range []syscall.Signal{syscall.SIGTERM, syscall.SIGINT} {
+			sig := sig
+
+			context(fmt.Sprintf("when the buildpack receives %s", sig), func() {
+				it("forwards it to the process group", func() {
+					go func() {
+						Eventually(filepath.Join(workingDir, "started")).Should(BeARegularFile())
+						Expect(syscall.Kill(os.Getpid(), sig)).To(Succeed())
+					}()
+
+					err := executable.Execute(pexec.Execution{
+						Args: []string{"-c", `
+trap 'echo stopped > stopped; exit 0' TERM
+echo started > started
+while true; do sleep 0.05; done`},
+						Dir: workingDir,
+					})
+					Expect(err).To(MatchError(fmt.Sprintf("terminated by signal: %s", sig)))
+					Expect(filepath.Join(workingDir, "stopped")).To(BeARegularFile())
+				})
+			})
+		}
+
+		context("when $BP_RAILS_ASSETS_TIMEOUT is a number of seconds", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_TIMEOUT", "60")
+			})
+
+			it("runs the executable", func() {
+				err := executable.Execute(pexec.Execution{
+					Args: []string{"-c", "true"},
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		context("failure cases", func() {
+			context("when $BP_RAILS_ASSETS_TIMEOUT cannot be parsed", func() {
+				it.Before(func() {
+					t.Setenv("BP_RAILS_ASSETS_TIMEOUT", "forever")
+				})
+
+				it("returns an error", func() {
+					err := executable.Execute(pexec.Execution{})
+					Expect(err).To(MatchError(ContainSubstring("failed to parse BP_RAILS_ASSETS_TIMEOUT")))
+				})
+			})
+
+			context("when the executable cannot be found", func() {
+				it.Before(func() {
+					executable = railsassets.NewProcessGroupExecutable("no-such-executable")
+				})
+
+				it("returns an error", func() {
+					err := executable.Execute(pexec.Execution{})
+					Expect(err).To(MatchError(ContainSubstring("executable file not found in $PATH")))
+				})
+			})
+
+			context("when the executable fails", func() {
+				it("returns the exit error", func() {
+					err := executable.Execute(pexec.Execution{
+						Args: []string{"-c", "exit 3"},
+					})
+					Expect(err).To(MatchError("exit status 3"))
+				})
+			})
+		})
+	})
+}
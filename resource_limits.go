@@ -0,0 +1,185 @@
+package railsassets
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// DefaultCgroupRoot is the location at which the cgroup filesystem is mounted
+// inside of the build container.
+const DefaultCgroupRoot = "/sys/fs/cgroup"
+
+// ResourceLimits describes the memory and CPU available to the build
+// container.
+type ResourceLimits struct {
+	// MemoryBytes is the memory limit in bytes, or 0 when unlimited.
+	MemoryBytes int64
+
+	// CPUs is the number of CPUs that the container may use, which is the
+	// smaller of its CPU quota and the number of CPUs on the host.
+	CPUs float64
+}
+
+// String returns a human readable description of the limits.
+func (l ResourceLimits) String() string {
+	memory := "unlimited"
+	if l.MemoryBytes > 0 {
+		memory = fmt.Sprintf("%d MiB", l.MemoryBytes/(1024*1024))
+	}
+
+	return fmt.Sprintf("memory=%s, cpus=%s", memory, strconv.FormatFloat(l.CPUs, 'f', -1, 64))
+}
+
+// ReadResourceLimits reads the memory and CPU limits of the current container
+// from the cgroup filesystem mounted at root. Both cgroup v2
+// (memory.max/cpu.max) and cgroup v1 (memory/memory.limit_in_bytes,
+// cpu/cpu.cfs_quota_us) layouts are supported.
+func ReadResourceLimits(root string) (ResourceLimits, error) {
+	limits := ResourceLimits{CPUs: float64(runtime.NumCPU())}
+
+	memory, err := readCgroupMemory(root)
+	if err != nil {
+		return ResourceLimits{}, err
+	}
+	limits.MemoryBytes = memory
+
+	cpus, err := readCgroupCPUs(root)
+	if err != nil {
+		return ResourceLimits{}, err
+	}
+	if cpus > 0 && cpus < limits.CPUs {
+		limits.CPUs = cpus
+	}
+
+	return limits, nil
+}
+
+func readCgroupMemory(root string) (int64, error) {
+	for _, path := range []string{
+		filepath.Join(root, "memory.max"),
+		filepath.Join(root, "memory", "memory.limit_in_bytes"),
+	} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return 0, fmt.Errorf("failed to read memory limit: %w", err)
+		}
+
+		value := strings.TrimSpace(string(content))
+		if value == "max" {
+			return 0, nil
+		}
+
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse memory limit %q: %w", value, err)
+		}
+
+		// cgroup v1 reports "no limit" as a very large number rounded down to
+		// the page size.
+		if limit >= math.MaxInt64/2 {
+			return 0, nil
+		}
+
+		return limit, nil
+	}
+
+	return 0, nil
+}
+
+func readCgroupCPUs(root string) (float64, error) {
+	content, err := os.ReadFile(filepath.Join(root, "cpu.max"))
+	if err == nil {
+		fields := strings.Fields(string(content))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, nil
+		}
+
+		return cpuQuota(fields[0], fields[1])
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("failed to read cpu limit: %w", err)
+	}
+
+	quota, err := os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read cpu limit: %w", err)
+	}
+
+	period, err := os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read cpu limit: %w", err)
+	}
+
+	return cpuQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+func cpuQuota(quota, period string) (float64, error) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse cpu quota %q: %w", quota, err)
+	}
+
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse cpu period %q: %w", period, err)
+	}
+
+	if q <= 0 || p <= 0 {
+		return 0, nil
+	}
+
+	return q / p, nil
+}
+
+// resourceLimitedEnv returns the variables that tune Node and Ruby to the
+// given limits. When the application uses Sprockets and the build container
+// has fewer CPUs than the host, $RAILS_ASSETS_EXPORT_CONCURRENCY is set to the
+// number of whole CPUs, for the application to size its asset exports with.
+// Variables that the user has already configured are left alone.
+func resourceLimitedEnv(env []string, limits ResourceLimits, sprockets bool) map[string]string {
+	existing := map[string]string{}
+	for _, pair := range env {
+		name, value, _ := strings.Cut(pair, "=")
+		existing[name] = value
+	}
+
+	tuned := map[string]string{}
+	if limits.MemoryBytes > 0 {
+		// Leave a quarter of the memory for Ruby and other processes.
+		heap := fmt.Sprintf("--max-old-space-size=%d", limits.MemoryBytes*3/4/(1024*1024))
+
+		options, ok := existing["NODE_OPTIONS"]
+		switch {
+		case !ok || options == "":
+			tuned["NODE_OPTIONS"] = heap
+		case !strings.Contains(options, "--max-old-space-size"):
+			tuned["NODE_OPTIONS"] = options + " " + heap
+		}
+
+		if _, ok := existing["MALLOC_ARENA_MAX"]; !ok {
+			tuned["MALLOC_ARENA_MAX"] = "2"
+		}
+	}
+
+	if _, ok := existing["RAILS_ASSETS_EXPORT_CONCURRENCY"]; sprockets && !ok && limits.CPUs < float64(runtime.NumCPU()) {
+		tuned["RAILS_ASSETS_EXPORT_CONCURRENCY"] = strconv.Itoa(max(1, int(limits.CPUs)))
+	}
+
+	return tuned
+}
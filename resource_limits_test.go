@@ -0,0 +1,116 @@
+package railsassets_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	railsassets "github.com/paketo-buildpacks/rails-assets"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testResourceLimits(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		root string
+	)
+
+	it.Before(func() {
+		var err error
+		root, err = os.MkdirTemp("", "cgroup")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	context("ReadResourceLimits", func() {
+		context("when there are cgroup v2 limits", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(root, "memory.max"), []byte("4294967296\n"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(root, "cpu.max"), []byte("50000 100000\n"), 0600)).To(Succeed())
+			})
+
+			it("returns the limits", func() {
+				limits, err := railsassets.ReadResourceLimits(root)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(limits).To(Equal(railsassets.ResourceLimits{MemoryBytes: 4294967296, CPUs: 0.5}))
+				Expect(limits.String()).To(Equal("memory=4096 MiB, cpus=0.5"))
+			})
+		})
+
+		context("when the cgroup v2 limits are unset", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(root, "memory.max"), []byte("max\n"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(root, "cpu.max"), []byte("max 100000\n"), 0600)).To(Succeed())
+			})
+
+			it("returns no memory limit and the host CPUs", func() {
+				limits, err := railsassets.ReadResourceLimits(root)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(limits).To(Equal(railsassets.ResourceLimits{CPUs: float64(runtime.NumCPU())}))
+			})
+		})
+
+		context("when there are cgroup v1 limits", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(root, "memory"), os.ModePerm)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(root, "cpu"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(root, "memory", "memory.limit_in_bytes"), []byte("2147483648\n"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us"), []byte("100000\n"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(root, "cpu", "cpu.cfs_period_us"), []byte("100000\n"), 0600)).To(Succeed())
+			})
+
+			it("returns the limits", func() {
+				limits, err := railsassets.ReadResourceLimits(root)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(limits).To(Equal(railsassets.ResourceLimits{MemoryBytes: 2147483648, CPUs: 1}))
+			})
+		})
+
+		context("when the cgroup v1 limits are unset", func() {
+			it.Before(func() {
+				Expect(os.MkdirAll(filepath.Join(root, "memory"), os.ModePerm)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(root, "cpu"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(root, "memory", "memory.limit_in_bytes"), []byte("9223372036854771712\n"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us"), []byte("-1\n"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(root, "cpu", "cpu.cfs_period_us"), []byte("100000\n"), 0600)).To(Succeed())
+			})
+
+			it("returns no memory limit and the host CPUs", func() {
+				limits, err := railsassets.ReadResourceLimits(root)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(limits).To(Equal(railsassets.ResourceLimits{CPUs: float64(runtime.NumCPU())}))
+			})
+		})
+
+		context("failure cases", func() {
+			context("when the memory limit cannot be parsed", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(root, "memory.max"), []byte("lots\n"), 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := railsassets.ReadResourceLimits(root)
+					Expect(err).To(MatchError(ContainSubstring(`failed to parse memory limit "lots"`)))
+				})
+			})
+
+			context("when the cpu quota cannot be parsed", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(root, "cpu.max"), []byte("some 100000\n"), 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, err := railsassets.ReadResourceLimits(root)
+					Expect(err).To(MatchError(ContainSubstring(`failed to parse cpu quota "some"`)))
+				})
+			})
+		})
+	})
+}
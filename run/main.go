@@ -6,8 +6,8 @@ import (
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/chronos"
 	"github.com/paketo-buildpacks/packit/v2/fs"
-	"github.com/paketo-buildpacks/packit/v2/pexec"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/paketo-buildpacks/packit/v2/servicebindings"
 	railsassets "github.com/paketo-buildpacks/rails-assets"
 )
 
@@ -18,11 +18,13 @@ func main() {
 		railsassets.Detect(railsassets.NewGemfileParser()),
 		railsassets.Build(
 			railsassets.NewPrecompileProcess(
-				pexec.NewExecutable("bundle"),
+				railsassets.NewProcessGroupExecutable("bundle"),
+				servicebindings.NewResolver(),
 				logger,
+				chronos.DefaultClock,
 			),
 			fs.NewChecksumCalculator(),
-			railsassets.NewDirectorySetup(),
+			railsassets.NewDirectorySetup(logger),
 			logger,
 			chronos.DefaultClock,
 		),
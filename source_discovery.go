@@ -0,0 +1,138 @@
+package railsassets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SourcePath is a directory, relative to the working directory, that the
+// application adds to the asset load path, along with the file that adds it.
+type SourcePath struct {
+	Path   string
+	Source string
+}
+
+// UnresolvedSourcePath is an addition to the asset load path that could not
+// be resolved without evaluating Ruby code.
+type UnresolvedSourcePath struct {
+	Expression string
+	Source     string
+}
+
+var (
+	assetsPathsRe  = regexp.MustCompile(`^\s*(?:Rails\.application\.)?config\.assets\.paths\s*(?:<<|\+=)\s*(.+?)\s*$`)
+	assetsPushRe   = regexp.MustCompile(`^\s*(?:Rails\.application\.)?config\.assets\.paths\.(?:push|append|unshift|prepend)(?:\((.+)\)|\s+(.+?))\s*$`)
+	railsRootJoin  = regexp.MustCompile(`^(?:Rails\.root|Rails\.application\.root|root)\.join\((.*)\)(?:\.to_s)?$`)
+	stringLiteral  = regexp.MustCompile(`^\s*(?:"([^"#]*)"|'([^']*)')\s*$`)
+	interpolatedRe = regexp.MustCompile(`^"#\{(?:Rails\.root|Rails\.application\.root|root)\}/([^"#]*)"$`)
+	wordArrayRe    = regexp.MustCompile(`^%w[\[(](.*)[\])]$`)
+)
+
+// DiscoverSourcePaths scans config/application.rb,
+// config/environments/production.rb and config/initializers/*.rb for literal
+// additions to config.assets.paths (which Propshaft also uses). Additions
+// that are not literal paths are returned as unresolved.
+func DiscoverSourcePaths(workingDir string) ([]SourcePath, []UnresolvedSourcePath, error) {
+	files := []string{
+		filepath.Join("config", "application.rb"),
+		filepath.Join("config", "environments", "production.rb"),
+	}
+
+	initializers, err := filepath.Glob(filepath.Join(workingDir, "config", "initializers", "*.rb"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, initializer := range initializers {
+		rel, err := filepath.Rel(workingDir, initializer)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, rel)
+	}
+
+	var (
+		paths      []SourcePath
+		unresolved []UnresolvedSourcePath
+	)
+
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.Join(workingDir, file))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+
+		for _, line := range strings.Split(string(content), "\n") {
+			var expression string
+			if matches := assetsPathsRe.FindStringSubmatch(line); matches != nil {
+				expression = matches[1]
+			} else if matches := assetsPushRe.FindStringSubmatch(line); matches != nil {
+				expression = matches[1] + matches[2]
+			} else {
+				continue
+			}
+
+			expressions := []string{strings.TrimSpace(expression)}
+			if words := wordArrayRe.FindStringSubmatch(expressions[0]); words != nil {
+				expressions = strings.Fields(words[1])
+				for i, word := range expressions {
+					expressions[i] = fmt.Sprintf("%q", word)
+				}
+			}
+
+			for _, expression := range expressions {
+				path, ok := resolveAssetsPath(expression)
+				if !ok {
+					unresolved = append(unresolved, UnresolvedSourcePath{Expression: expression, Source: file})
+					continue
+				}
+
+				paths = append(paths, SourcePath{Path: path, Source: file})
+			}
+		}
+	}
+
+	return paths, unresolved, nil
+}
+
+// resolveAssetsPath statically evaluates a Ruby expression that names a
+// directory relative to the application root.
+func resolveAssetsPath(expression string) (string, bool) {
+	var segments []string
+
+	switch {
+	case railsRootJoin.MatchString(expression):
+		args := railsRootJoin.FindStringSubmatch(expression)[1]
+		for _, arg := range strings.Split(args, ",") {
+			literal := stringLiteral.FindStringSubmatch(arg)
+			if literal == nil {
+				return "", false
+			}
+			segments = append(segments, literal[1]+literal[2])
+		}
+
+	case interpolatedRe.MatchString(expression):
+		segments = append(segments, interpolatedRe.FindStringSubmatch(expression)[1])
+
+	case stringLiteral.MatchString(expression):
+		literal := stringLiteral.FindStringSubmatch(expression)
+		segments = append(segments, literal[1]+literal[2])
+
+	default:
+		return "", false
+	}
+
+	path := filepath.Clean(filepath.Join(segments...))
+	if filepath.IsAbs(path) || path == "." || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return path, true
+}
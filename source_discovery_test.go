@@ -0,0 +1,91 @@
+package railsassets_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	railsassets "github.com/paketo-buildpacks/rails-assets"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testSourceDiscovery(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(workingDir, "config", "initializers"), os.ModePerm)).To(Succeed())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("DiscoverSourcePaths", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "config", "application.rb"), []byte(`
+module SomeApp
+  class Application < Rails::Application
+    config.assets.paths << Rails.root.join("app/frontend")
+    config.assets.paths << Rails.root.join("vendor", "themes", 'dark')
+  end
+end
+`), 0600)).To(Succeed())
+
+			Expect(os.WriteFile(filepath.Join(workingDir, "config", "initializers", "assets.rb"), []byte(`
+Rails.application.config.assets.version = "1.0"
+Rails.application.config.assets.paths << "#{Rails.root}/lib/fonts"
+Rails.application.config.assets.paths.unshift("app/icons")
+Rails.application.config.assets.paths += %w(app/one app/two)
+Rails.application.config.assets.paths << Rails.root.join("node_modules").to_s
+Rails.application.config.assets.paths << Gem.loaded_specs["some-gem"].full_gem_path
+Rails.application.config.assets.paths << "/opt/shared/assets"
+`), 0600)).To(Succeed())
+		})
+
+		it("returns the literal paths and the expressions that cannot be resolved", func() {
+			paths, unresolved, err := railsassets.DiscoverSourcePaths(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			application := filepath.Join("config", "application.rb")
+			initializer := filepath.Join("config", "initializers", "assets.rb")
+
+			Expect(paths).To(Equal([]railsassets.SourcePath{
+				{Path: filepath.Join("app", "frontend"), Source: application},
+				{Path: filepath.Join("vendor", "themes", "dark"), Source: application},
+				{Path: filepath.Join("lib", "fonts"), Source: initializer},
+				{Path: filepath.Join("app", "icons"), Source: initializer},
+				{Path: filepath.Join("app", "one"), Source: initializer},
+				{Path: filepath.Join("app", "two"), Source: initializer},
+				{Path: "node_modules", Source: initializer},
+			}))
+
+			Expect(unresolved).To(Equal([]railsassets.UnresolvedSourcePath{
+				{Expression: `Gem.loaded_specs["some-gem"].full_gem_path`, Source: initializer},
+				{Expression: `"/opt/shared/assets"`, Source: initializer},
+			}))
+		})
+
+		context("failure cases", func() {
+			context("when a config file cannot be read", func() {
+				it.Before(func() {
+					Expect(os.MkdirAll(filepath.Join(workingDir, "config", "environments", "production.rb"), os.ModePerm)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, _, err := railsassets.DiscoverSourcePaths(workingDir)
+					Expect(err).To(MatchError(ContainSubstring("failed to read config/environments/production.rb")))
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,387 @@
+package railsassets
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	iofs "io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SourceMapPolicy is how the buildpack handles the source maps that the asset
+// pipelines write next to the compiled assets.
+type SourceMapPolicy string
+
+const (
+	// SourceMapsKeep leaves the source maps where the asset pipelines wrote
+	// them, so they are served with the assets.
+	SourceMapsKeep SourceMapPolicy = "keep"
+
+	// SourceMapsStrip removes the source maps and the comments that refer to
+	// them.
+	SourceMapsStrip SourceMapPolicy = "strip"
+
+	// SourceMapsSeparate moves the source maps out of the application into
+	// the "source-maps" layer, which is not available at launch, and removes
+	// the comments that refer to them.
+	SourceMapsSeparate SourceMapPolicy = "separate"
+)
+
+// ParseSourceMapPolicy reads $BP_RAILS_ASSETS_SOURCE_MAPS, which defaults to
+// "keep".
+func ParseSourceMapPolicy() (SourceMapPolicy, error) {
+	switch policy := SourceMapPolicy(os.Getenv("BP_RAILS_ASSETS_SOURCE_MAPS")); policy {
+	case "":
+		return SourceMapsKeep, nil
+	case SourceMapsKeep, SourceMapsStrip, SourceMapsSeparate:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid BP_RAILS_ASSETS_SOURCE_MAPS %q: must be %q, %q or %q", policy, SourceMapsKeep, SourceMapsStrip, SourceMapsSeparate)
+	}
+}
+
+// SourceMapResult counts the source maps that were removed from the
+// application and the compiled assets whose sourceMappingURL comment was
+// removed.
+type SourceMapResult struct {
+	Maps     int
+	Comments int
+}
+
+var sourceMappingURLRe = regexp.MustCompile(`(?m)(?:^[ \t]*//[#@][ \t]*sourceMappingURL=\S*[ \t]*$|/\*[#@][ \t]*sourceMappingURL=[^*]*\*/)\n?`)
+
+// RemoveSourceMaps removes the source maps from the output directories of the
+// asset pipelines, along with their gzip and brotli variants. When destination
+// is not empty, the source maps are moved there instead, keeping their paths
+// relative to the working directory. The sourceMappingURL comments are removed
+// from the JavaScript and CSS files, whose precompressed variants are written
+// again. The manifests no longer list the source maps, and the integrity
+// hashes they record for the rewritten files are updated.
+func RemoveSourceMaps(workingDir, destination string) (SourceMapResult, error) {
+	files, err := compiledFiles(workingDir)
+	if err != nil {
+		return SourceMapResult{}, err
+	}
+
+	var (
+		result  SourceMapResult
+		removed = map[string]bool{}
+		changed = map[string]bool{}
+	)
+
+	for _, path := range files {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".map":
+			if destination != "" {
+				rel, err := filepath.Rel(workingDir, path)
+				if err != nil {
+					return SourceMapResult{}, err
+				}
+
+				err = copyFile(path, filepath.Join(destination, rel))
+				if err != nil {
+					return SourceMapResult{}, err
+				}
+			}
+
+			for _, file := range []string{path, path + PrecompressGzip.Extension(), path + PrecompressBrotli.Extension()} {
+				err = os.Remove(file)
+				if err != nil && !os.IsNotExist(err) {
+					return SourceMapResult{}, err
+				}
+			}
+
+			removed[path] = true
+			result.Maps++
+
+		case ".js", ".mjs", ".css":
+			stripped, err := stripSourceMappingURL(path)
+			if err != nil {
+				return SourceMapResult{}, err
+			}
+
+			if stripped {
+				changed[path] = true
+				result.Comments++
+			}
+		}
+	}
+
+	if len(removed) == 0 && len(changed) == 0 {
+		return result, nil
+	}
+
+	lock, err := NewGemfileLockParser().Parse(filepath.Join(workingDir, "Gemfile.lock"))
+	if err != nil {
+		return SourceMapResult{}, err
+	}
+
+	locations, _, err := findAssetManifests(workingDir, lock)
+	if err != nil {
+		return SourceMapResult{}, err
+	}
+
+	for _, location := range locations {
+		err = updateManifest(workingDir, location, removed, changed)
+		if err != nil {
+			return SourceMapResult{}, err
+		}
+	}
+
+	return result, nil
+}
+
+// stripSourceMappingURL removes the sourceMappingURL comments from a file and
+// writes its existing precompressed variants again. It reports whether the
+// file had any.
+func stripSourceMappingURL(path string) (bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	stripped := sourceMappingURLRe.ReplaceAll(content, nil)
+	if len(stripped) == len(content) {
+		return false, nil
+	}
+
+	err = replaceFile(path, stripped)
+	if err != nil {
+		return false, err
+	}
+
+	for _, format := range []PrecompressFormat{PrecompressGzip, PrecompressBrotli} {
+		if !exists(path + format.Extension()) {
+			continue
+		}
+
+		err = os.Remove(path + format.Extension())
+		if err != nil {
+			return false, err
+		}
+
+		_, err = writeCompressedVariant(path, format)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// updateManifest removes the entries for the removed files from a manifest,
+// and updates the integrity hashes and sizes that it records for the changed
+// files. The paths of the files are those returned by compiledFiles, and are
+// compared with the links into the "assets" layer resolved. The manifest is
+// only written when it changes.
+func updateManifest(workingDir string, location manifestLocation, removed, changed map[string]bool) error {
+	path := filepath.Join(workingDir, location.path)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var manifest map[string]interface{}
+	err = json.Unmarshal(content, &manifest)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", location.path, err)
+	}
+
+	removed, changed = realPaths(removed), realPaths(changed)
+
+	resolve := func(file string) string {
+		if parsed, err := url.Parse(file); err == nil && parsed.Host != "" {
+			file = parsed.Path
+		}
+		return realPath(filepath.Join(workingDir, location.root, filepath.FromSlash(strings.TrimPrefix(file, "/"))))
+	}
+
+	var (
+		modified bool
+		update   func(entries map[string]interface{}) error
+	)
+
+	// Entries map a logical path to a file name, or to an object that names
+	// the file in "digested_path" (Propshaft) or "src" (Webpacker). The files
+	// in a Sprockets manifest are the keys of its "files" object.
+	update = func(entries map[string]interface{}) error {
+		for key, value := range entries {
+			file := key
+			switch value := value.(type) {
+			case string:
+				file = value
+			case map[string]interface{}:
+				for _, field := range []string{"digested_path", "src"} {
+					if name, ok := value[field].(string); ok {
+						file = name
+					}
+				}
+			}
+
+			if removed[resolve(file)] {
+				delete(entries, key)
+				modified = true
+				continue
+			}
+
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			if integrity, ok := object["integrity"].(string); ok && changed[resolve(file)] {
+				object["integrity"], err = integrityHash(resolve(file), integrity)
+				if err != nil {
+					return err
+				}
+				modified = true
+			}
+
+			if _, ok := object["size"].(float64); ok && changed[resolve(file)] {
+				info, err := os.Stat(resolve(file))
+				if err != nil {
+					return err
+				}
+				object["size"] = info.Size()
+				modified = true
+			}
+
+			err = update(object)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	err = update(manifest)
+	if err != nil {
+		return err
+	}
+
+	if !modified {
+		return nil
+	}
+
+	var updated []byte
+	if bytes.Contains(bytes.TrimSpace(content), []byte("\n")) {
+		updated, err = json.MarshalIndent(manifest, "", "  ")
+	} else {
+		updated, err = json.Marshal(manifest)
+	}
+	if err != nil {
+		return err
+	}
+
+	return replaceFile(path, updated)
+}
+
+// realPath resolves the links in the directory of a path, which may no longer
+// exist itself, so that a path through a link into the "assets" layer
+// compares equal to the path that it points to.
+func realPath(path string) string {
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return path
+	}
+	return filepath.Join(dir, filepath.Base(path))
+}
+
+// realPaths applies realPath to each path in a set.
+func realPaths(paths map[string]bool) map[string]bool {
+	result := map[string]bool{}
+	for path := range paths {
+		result[realPath(path)] = true
+	}
+	return result
+}
+
+// integrityHash computes the subresource integrity hash of a file with each of
+// the algorithms used in an existing hash, such as "sha256-...". It defaults
+// to SHA-384.
+func integrityHash(path, existing string) (string, error) {
+	algorithms := []string{}
+	for _, token := range strings.Fields(existing) {
+		algorithm, _, _ := strings.Cut(token, "-")
+		algorithms = append(algorithms, algorithm)
+	}
+
+	if len(algorithms) == 0 {
+		algorithms = []string{"sha384"}
+	}
+
+	var hashes []string
+	for _, algorithm := range algorithms {
+		var h hash.Hash
+		switch algorithm {
+		case "sha256":
+			h = sha256.New()
+		case "sha512":
+			h = sha512.New()
+		default:
+			algorithm, h = "sha384", sha512.New384()
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = io.Copy(h, file)
+		file.Close()
+		if err != nil {
+			return "", err
+		}
+
+		hashes = append(hashes, algorithm+"-"+base64.StdEncoding.EncodeToString(h.Sum(nil)))
+	}
+
+	return strings.Join(hashes, " "), nil
+}
+
+// copyFile copies a file, creating the directories that lead to the
+// destination.
+func copyFile(source, destination string) error {
+	err := os.MkdirAll(filepath.Dir(destination), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(destination, content, 0644)
+}
+
+// copyTree copies the files in a directory into another, which may already
+// exist, keeping their relative paths.
+func copyTree(source, destination string) error {
+	return filepath.WalkDir(source, func(path string, entry iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+
+		return copyFile(path, filepath.Join(destination, rel))
+	})
+}
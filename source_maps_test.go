@@ -0,0 +1,273 @@
+package railsassets_test
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	railsassets "github.com/paketo-buildpacks/rails-assets"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testSourceMaps(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+		layerDir   string
+		assetsDir  string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		layerDir, err = os.MkdirTemp("", "layer")
+		Expect(err).NotTo(HaveOccurred())
+
+		assetsDir = filepath.Join(workingDir, "public", "assets")
+		Expect(os.MkdirAll(assetsDir, os.ModePerm)).To(Succeed())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+		Expect(os.RemoveAll(layerDir)).To(Succeed())
+	})
+
+	// linkIntoLayer moves an output directory into the layer and links it
+	// back, as the default symlink mode does.
+	linkIntoLayer := func(path string) {
+		Expect(os.Rename(filepath.Join(workingDir, path), filepath.Join(layerDir, filepath.Base(path)))).To(Succeed())
+		Expect(os.Symlink(filepath.Join(layerDir, filepath.Base(path)), filepath.Join(workingDir, path))).To(Succeed())
+	}
+
+	context("ParseSourceMapPolicy", func() {
+		it("defaults to keep", func() {
+			policy, err := railsassets.ParseSourceMapPolicy()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy).To(Equal(railsassets.SourceMapsKeep))
+		})
+
+		context("when BP_RAILS_ASSETS_SOURCE_MAPS is set", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_SOURCE_MAPS", "separate")
+			})
+
+			it("returns the policy", func() {
+				policy, err := railsassets.ParseSourceMapPolicy()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(policy).To(Equal(railsassets.SourceMapsSeparate))
+			})
+		})
+
+		context("when BP_RAILS_ASSETS_SOURCE_MAPS is invalid", func() {
+			it.Before(func() {
+				t.Setenv("BP_RAILS_ASSETS_SOURCE_MAPS", "hide")
+			})
+
+			it("returns an error", func() {
+				_, err := railsassets.ParseSourceMapPolicy()
+				Expect(err).To(MatchError(`invalid BP_RAILS_ASSETS_SOURCE_MAPS "hide": must be "keep", "strip" or "separate"`))
+			})
+		})
+	})
+
+	context("RemoveSourceMaps", func() {
+		context("with a Propshaft manifest", func() {
+			var script string
+
+			it.Before(func() {
+				script = strings.Repeat("console.log(1);\n", 20)
+
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    propshaft (1.2.0)\n"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(assetsDir, ".manifest.json"), []byte(`{
+  "application.js": {"digested_path": "application-abc.js", "integrity": "sha384-old"},
+  "application.js.map": {"digested_path": "application-abc.js.map", "integrity": null},
+  "application.css": {"digested_path": "application-def.css", "integrity": "sha256-old"}
+}`), 0600)).To(Succeed())
+
+				Expect(os.WriteFile(filepath.Join(assetsDir, "application-abc.js"), []byte(script+"//# sourceMappingURL=application-abc.js.map\n"), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(assetsDir, "application-abc.js.gz"), []byte("stale"), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(assetsDir, "application-abc.js.map"), []byte(`{"version":3}`), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(assetsDir, "application-abc.js.map.gz"), []byte("map"), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(assetsDir, "application-def.css"), []byte("body{}\n/*# sourceMappingURL=application-def.css.map */\n"), 0644)).To(Succeed())
+			})
+
+			it("removes the source maps and the comments that refer to them", func() {
+				result, err := railsassets.RemoveSourceMaps(workingDir, "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(railsassets.SourceMapResult{Maps: 1, Comments: 2}))
+
+				Expect(filepath.Join(assetsDir, "application-abc.js.map")).NotTo(BeAnExistingFile())
+				Expect(filepath.Join(assetsDir, "application-abc.js.map.gz")).NotTo(BeAnExistingFile())
+
+				Expect(os.ReadFile(filepath.Join(assetsDir, "application-abc.js"))).To(Equal([]byte(script)))
+				Expect(os.ReadFile(filepath.Join(assetsDir, "application-def.css"))).To(Equal([]byte("body{}\n")))
+
+				file, err := os.Open(filepath.Join(assetsDir, "application-abc.js.gz"))
+				Expect(err).NotTo(HaveOccurred())
+				defer file.Close()
+
+				reader, err := gzip.NewReader(file)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(io.ReadAll(reader)).To(Equal([]byte(script)))
+			})
+
+			it("updates the manifest", func() {
+				_, err := railsassets.RemoveSourceMaps(workingDir, "")
+				Expect(err).NotTo(HaveOccurred())
+
+				content, err := os.ReadFile(filepath.Join(assetsDir, ".manifest.json"))
+				Expect(err).NotTo(HaveOccurred())
+
+				var manifest map[string]map[string]interface{}
+				Expect(json.Unmarshal(content, &manifest)).To(Succeed())
+				Expect(manifest).NotTo(HaveKey("application.js.map"))
+
+				js := sha512.Sum384([]byte(script))
+				Expect(manifest["application.js"]).To(HaveKeyWithValue("integrity", "sha384-"+base64.StdEncoding.EncodeToString(js[:])))
+
+				css := sha256.Sum256([]byte("body{}\n"))
+				Expect(manifest["application.css"]).To(HaveKeyWithValue("integrity", "sha256-"+base64.StdEncoding.EncodeToString(css[:])))
+			})
+
+			context("when public/assets is a link into a layer", func() {
+				it.Before(func() {
+					linkIntoLayer(filepath.Join("public", "assets"))
+				})
+
+				it("updates the manifest", func() {
+					_, err := railsassets.RemoveSourceMaps(workingDir, "")
+					Expect(err).NotTo(HaveOccurred())
+
+					content, err := os.ReadFile(filepath.Join(assetsDir, ".manifest.json"))
+					Expect(err).NotTo(HaveOccurred())
+
+					var manifest map[string]map[string]interface{}
+					Expect(json.Unmarshal(content, &manifest)).To(Succeed())
+					Expect(manifest).NotTo(HaveKey("application.js.map"))
+
+					js := sha512.Sum384([]byte(script))
+					Expect(manifest["application.js"]).To(HaveKeyWithValue("integrity", "sha384-"+base64.StdEncoding.EncodeToString(js[:])))
+
+					problems, err := railsassets.VerifyAssets(workingDir, time.Time{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(problems).To(BeEmpty())
+				})
+			})
+
+			context("when a destination is given", func() {
+				var destination string
+
+				it.Before(func() {
+					var err error
+					destination, err = os.MkdirTemp("", "destination")
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				it.After(func() {
+					Expect(os.RemoveAll(destination)).To(Succeed())
+				})
+
+				it("moves the source maps there", func() {
+					_, err := railsassets.RemoveSourceMaps(workingDir, destination)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(filepath.Join(assetsDir, "application-abc.js.map")).NotTo(BeAnExistingFile())
+					Expect(os.ReadFile(filepath.Join(destination, "public", "assets", "application-abc.js.map"))).To(Equal([]byte(`{"version":3}`)))
+				})
+			})
+		})
+
+		context("with a Sprockets manifest", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    sprockets-rails (3.5.0)\n"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(assetsDir, ".sprockets-manifest-123.json"), []byte(`{"files":{"application-abc.js":{"logical_path":"application.js","integrity":"sha256-old"},"application-abc.js.map":{"logical_path":"application.js.map"}},"assets":{"application.js":"application-abc.js","application.js.map":"application-abc.js.map"}}`), 0600)).To(Succeed())
+
+				Expect(os.WriteFile(filepath.Join(assetsDir, "application-abc.js"), []byte("alert(1);\n//# sourceMappingURL=application-abc.js.map"), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(assetsDir, "application-abc.js.map"), []byte(`{"version":3}`), 0644)).To(Succeed())
+			})
+
+			it("updates the manifest", func() {
+				_, err := railsassets.RemoveSourceMaps(workingDir, "")
+				Expect(err).NotTo(HaveOccurred())
+
+				content, err := os.ReadFile(filepath.Join(assetsDir, ".sprockets-manifest-123.json"))
+				Expect(err).NotTo(HaveOccurred())
+
+				sum := sha256.Sum256([]byte("alert(1);\n"))
+				Expect(string(content)).To(Equal(`{"assets":{"application.js":"application-abc.js"},"files":{"application-abc.js":{"integrity":"sha256-` + base64.StdEncoding.EncodeToString(sum[:]) + `","logical_path":"application.js"}}}`))
+			})
+
+			context("when public/assets is a link into a layer", func() {
+				it.Before(func() {
+					linkIntoLayer(filepath.Join("public", "assets"))
+				})
+
+				it("updates the manifest", func() {
+					_, err := railsassets.RemoveSourceMaps(workingDir, "")
+					Expect(err).NotTo(HaveOccurred())
+
+					content, err := os.ReadFile(filepath.Join(assetsDir, ".sprockets-manifest-123.json"))
+					Expect(err).NotTo(HaveOccurred())
+
+					sum := sha256.Sum256([]byte("alert(1);\n"))
+					Expect(string(content)).To(Equal(`{"assets":{"application.js":"application-abc.js"},"files":{"application-abc.js":{"integrity":"sha256-` + base64.StdEncoding.EncodeToString(sum[:]) + `","logical_path":"application.js"}}}`))
+				})
+			})
+		})
+
+		context("with a Vite manifest in a link into a layer", func() {
+			it.Before(func() {
+				viteDir := filepath.Join(workingDir, "public", "vite")
+				Expect(os.MkdirAll(filepath.Join(viteDir, ".vite"), os.ModePerm)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(viteDir, "assets"), os.ModePerm)).To(Succeed())
+
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    vite_ruby (3.5.0)\n"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(viteDir, ".vite", "manifest.json"), []byte(`{"app.js":{"file":"assets/app-abc.js"},"app-abc.js.map":"assets/app-abc.js.map"}`), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(viteDir, "assets", "app-abc.js"), []byte("alert(1);\n//# sourceMappingURL=app-abc.js.map"), 0644)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(viteDir, "assets", "app-abc.js.map"), []byte(`{"version":3}`), 0644)).To(Succeed())
+
+				linkIntoLayer(filepath.Join("public", "vite"))
+			})
+
+			it("removes the source maps from the manifest", func() {
+				_, err := railsassets.RemoveSourceMaps(workingDir, "")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(os.ReadFile(filepath.Join(workingDir, "public", "vite", ".vite", "manifest.json"))).To(Equal([]byte(`{"app.js":{"file":"assets/app-abc.js"}}`)))
+
+				problems, err := railsassets.VerifyAssets(workingDir, time.Time{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(problems).To(BeEmpty())
+			})
+		})
+
+		context("when there are no source maps", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "Gemfile.lock"), []byte("GEM\n  specs:\n    propshaft (1.2.0)\n"), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(assetsDir, ".manifest.json"), []byte(`{"application.js": "application-abc.js"}`), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(assetsDir, "application-abc.js"), []byte("console.log(1);\n"), 0644)).To(Succeed())
+			})
+
+			it("leaves the assets and the manifest alone", func() {
+				result, err := railsassets.RemoveSourceMaps(workingDir, "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(railsassets.SourceMapResult{}))
+
+				Expect(os.ReadFile(filepath.Join(assetsDir, ".manifest.json"))).To(Equal([]byte(`{"application.js": "application-abc.js"}`)))
+			})
+		})
+	})
+}
@@ -0,0 +1,89 @@
+package railsassets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ViteConfig holds the production settings of a Vite Ruby application that
+// determine where its sources are read from and where compiled assets are
+// written.
+type ViteConfig struct {
+	// ConfigPath is the path of the configuration file, relative to the
+	// working directory.
+	ConfigPath string
+
+	// SourceCodeDir is the directory, relative to the working directory, that
+	// contains the frontend sources.
+	SourceCodeDir string
+
+	// PublicOutputDir is the directory, relative to the working directory,
+	// that compiled assets and the Vite manifest are written to.
+	PublicOutputDir string
+}
+
+type viteEnvironmentConfig struct {
+	PublicDir       string `json:"publicDir"`
+	PublicOutputDir string `json:"publicOutputDir"`
+	SourceCodeDir   string `json:"sourceCodeDir"`
+}
+
+// ParseViteConfig determines whether the application compiles its assets
+// with Vite Ruby and, if so, reads the "all" and "production" settings from
+// config/vite.json. $VITE_RUBY_PUBLIC_OUTPUT_DIR takes precedence over the
+// file, as it does for Vite Ruby itself. It returns false when neither
+// vite_rails nor vite_ruby is in the Gemfile.lock.
+func ParseViteConfig(workingDir string, lock GemfileLock) (ViteConfig, bool, error) {
+	if !lock.Has("vite_ruby") && !lock.Has("vite_rails") {
+		return ViteConfig{}, false, nil
+	}
+
+	config := ViteConfig{ConfigPath: filepath.Join("config", "vite.json")}
+	settings := viteEnvironmentConfig{
+		PublicDir:       "public",
+		PublicOutputDir: "vite",
+		SourceCodeDir:   filepath.Join("app", "frontend"),
+	}
+
+	content, err := os.ReadFile(filepath.Join(workingDir, config.ConfigPath))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return ViteConfig{}, false, fmt.Errorf("failed to read %s: %w", config.ConfigPath, err)
+	}
+
+	if err == nil {
+		var environments map[string]viteEnvironmentConfig
+		err = json.Unmarshal(content, &environments)
+		if err != nil {
+			return ViteConfig{}, false, fmt.Errorf("failed to parse %s: %w", config.ConfigPath, err)
+		}
+
+		for _, name := range []string{"all", "production"} {
+			environment, ok := environments[name]
+			if !ok {
+				continue
+			}
+
+			if environment.PublicDir != "" {
+				settings.PublicDir = environment.PublicDir
+			}
+			if environment.PublicOutputDir != "" {
+				settings.PublicOutputDir = environment.PublicOutputDir
+			}
+			if environment.SourceCodeDir != "" {
+				settings.SourceCodeDir = environment.SourceCodeDir
+			}
+		}
+	}
+
+	if dir, ok := os.LookupEnv("VITE_RUBY_PUBLIC_OUTPUT_DIR"); ok && dir != "" {
+		settings.PublicOutputDir = dir
+	}
+
+	config.PublicOutputDir = filepath.Clean(filepath.Join(settings.PublicDir, settings.PublicOutputDir))
+	config.SourceCodeDir = filepath.Clean(settings.SourceCodeDir)
+
+	return config, true, nil
+}
@@ -0,0 +1,109 @@
+package railsassets_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	railsassets "github.com/paketo-buildpacks/rails-assets"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testViteConfig(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+		lock       railsassets.GemfileLock
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(workingDir, "config"), os.ModePerm)).To(Succeed())
+
+		lock = railsassets.GemfileLock{Gems: map[string]string{"vite_rails": "3.0.17", "vite_ruby": "3.5.0"}}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("ParseViteConfig", func() {
+		it("uses the defaults when there is no config file", func() {
+			config, ok, err := railsassets.ParseViteConfig(workingDir, lock)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(config).To(Equal(railsassets.ViteConfig{
+				ConfigPath:      filepath.Join("config", "vite.json"),
+				SourceCodeDir:   filepath.Join("app", "frontend"),
+				PublicOutputDir: filepath.Join("public", "vite"),
+			}))
+		})
+
+		context("when there is a config/vite.json", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "config", "vite.json"), []byte(`{
+  "all": {
+    "sourceCodeDir": "app/javascript",
+    "watchAdditionalPaths": []
+  },
+  "development": {
+    "publicOutputDir": "vite-dev"
+  },
+  "production": {
+    "publicOutputDir": "build/vite"
+  }
+}`), 0600)).To(Succeed())
+			})
+
+			it("reads the production settings", func() {
+				config, ok, err := railsassets.ParseViteConfig(workingDir, lock)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ok).To(BeTrue())
+				Expect(config).To(Equal(railsassets.ViteConfig{
+					ConfigPath:      filepath.Join("config", "vite.json"),
+					SourceCodeDir:   filepath.Join("app", "javascript"),
+					PublicOutputDir: filepath.Join("public", "build", "vite"),
+				}))
+			})
+
+			context("when VITE_RUBY_PUBLIC_OUTPUT_DIR is set", func() {
+				it.Before(func() {
+					t.Setenv("VITE_RUBY_PUBLIC_OUTPUT_DIR", "from-env")
+				})
+
+				it("takes precedence over the file", func() {
+					config, _, err := railsassets.ParseViteConfig(workingDir, lock)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(config.PublicOutputDir).To(Equal(filepath.Join("public", "from-env")))
+				})
+			})
+		})
+
+		context("when the app does not use vite ruby", func() {
+			it("returns false", func() {
+				_, ok, err := railsassets.ParseViteConfig(workingDir, railsassets.GemfileLock{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ok).To(BeFalse())
+			})
+		})
+
+		context("failure cases", func() {
+			context("when config/vite.json cannot be parsed", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "config", "vite.json"), []byte("{"), 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, _, err := railsassets.ParseViteConfig(workingDir, lock)
+					Expect(err).To(MatchError(ContainSubstring("failed to parse config/vite.json")))
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,117 @@
+package railsassets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// WebpackerConfig holds the production settings of a Webpacker or
+// Shakapacker application that determine where compiled packs are written.
+type WebpackerConfig struct {
+	// Gem is either "webpacker" or "shakapacker".
+	Gem string
+
+	// ConfigPath is the path of the configuration file, relative to the
+	// working directory.
+	ConfigPath string
+
+	// PublicRootPath is the directory, relative to the working directory,
+	// that the paths in manifest.json are relative to.
+	PublicRootPath string
+
+	// PublicOutputPath is the directory, relative to the working directory,
+	// that compiled packs and manifest.json are written to.
+	PublicOutputPath string
+
+	// CachePath is the directory, relative to the working directory, that
+	// holds the compilation cache.
+	CachePath string
+}
+
+// ManifestPath returns the path of the manifest.json written by a successful
+// compilation, relative to the working directory.
+func (c WebpackerConfig) ManifestPath() string {
+	return filepath.Join(c.PublicOutputPath, "manifest.json")
+}
+
+type webpackerEnvironmentConfig struct {
+	PublicRootPath   string `yaml:"public_root_path"`
+	PublicOutputPath string `yaml:"public_output_path"`
+	CachePath        string `yaml:"cache_path"`
+}
+
+// ParseWebpackerConfig determines whether the application compiles its
+// JavaScript with Shakapacker or Webpacker and, if so, reads the production
+// settings from config/shakapacker.yml or config/webpacker.yml. It returns
+// false when neither gem is in the Gemfile.lock.
+func ParseWebpackerConfig(workingDir string, lock GemfileLock) (WebpackerConfig, bool, error) {
+	var config WebpackerConfig
+	switch {
+	case lock.Has("shakapacker"):
+		config = WebpackerConfig{
+			Gem:        "shakapacker",
+			ConfigPath: filepath.Join("config", "shakapacker.yml"),
+			CachePath:  filepath.Join("tmp", "shakapacker"),
+		}
+
+		// Shakapacker still reads config/webpacker.yml when it has not been
+		// renamed yet.
+		if _, err := os.Stat(filepath.Join(workingDir, config.ConfigPath)); errors.Is(err, os.ErrNotExist) {
+			config.ConfigPath = filepath.Join("config", "webpacker.yml")
+		}
+	case lock.Has("webpacker"):
+		config = WebpackerConfig{
+			Gem:        "webpacker",
+			ConfigPath: filepath.Join("config", "webpacker.yml"),
+			CachePath:  filepath.Join("tmp", "cache", "webpacker"),
+		}
+	default:
+		return WebpackerConfig{}, false, nil
+	}
+
+	settings := webpackerEnvironmentConfig{
+		PublicRootPath:   "public",
+		PublicOutputPath: "packs",
+		CachePath:        config.CachePath,
+	}
+
+	content, err := os.ReadFile(filepath.Join(workingDir, config.ConfigPath))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return WebpackerConfig{}, false, fmt.Errorf("failed to read %s: %w", config.ConfigPath, err)
+	}
+
+	if err == nil {
+		var environments map[string]webpackerEnvironmentConfig
+		err = yaml.Unmarshal(content, &environments)
+		if err != nil {
+			return WebpackerConfig{}, false, fmt.Errorf("failed to parse %s: %w", config.ConfigPath, err)
+		}
+
+		for _, name := range []string{"default", "production"} {
+			environment, ok := environments[name]
+			if !ok {
+				continue
+			}
+
+			if environment.PublicRootPath != "" {
+				settings.PublicRootPath = environment.PublicRootPath
+			}
+			if environment.PublicOutputPath != "" {
+				settings.PublicOutputPath = environment.PublicOutputPath
+			}
+			if environment.CachePath != "" {
+				settings.CachePath = environment.CachePath
+			}
+		}
+	}
+
+	config.PublicRootPath = filepath.Clean(settings.PublicRootPath)
+	config.PublicOutputPath = filepath.Clean(filepath.Join(settings.PublicRootPath, settings.PublicOutputPath))
+	config.CachePath = filepath.Clean(settings.CachePath)
+
+	return config, true, nil
+}
@@ -0,0 +1,138 @@
+package railsassets_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	railsassets "github.com/paketo-buildpacks/rails-assets"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testWebpackerConfig(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(workingDir, "config"), os.ModePerm)).To(Succeed())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("ParseWebpackerConfig", func() {
+		context("when the app uses shakapacker", func() {
+			var lock railsassets.GemfileLock
+
+			it.Before(func() {
+				lock = railsassets.GemfileLock{Gems: map[string]string{"shakapacker": "7.2.0"}}
+
+				Expect(os.WriteFile(filepath.Join(workingDir, "config", "shakapacker.yml"), []byte(`
+default: &default
+  source_path: app/javascript
+  public_root_path: public
+  public_output_path: packs
+  cache_path: tmp/shakapacker
+
+development:
+  <<: *default
+  public_output_path: packs-dev
+
+production:
+  <<: *default
+  public_output_path: compiled/js
+  cache_path: tmp/cache/packs
+`), 0600)).To(Succeed())
+			})
+
+			it("reads the production settings", func() {
+				config, ok, err := railsassets.ParseWebpackerConfig(workingDir, lock)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ok).To(BeTrue())
+				Expect(config).To(Equal(railsassets.WebpackerConfig{
+					Gem:              "shakapacker",
+					ConfigPath:       filepath.Join("config", "shakapacker.yml"),
+					PublicRootPath:   "public",
+					PublicOutputPath: filepath.Join("public", "compiled", "js"),
+					CachePath:        filepath.Join("tmp", "cache", "packs"),
+				}))
+				Expect(config.ManifestPath()).To(Equal(filepath.Join("public", "compiled", "js", "manifest.json")))
+			})
+
+			context("when there is no config file", func() {
+				it.Before(func() {
+					Expect(os.Remove(filepath.Join(workingDir, "config", "shakapacker.yml"))).To(Succeed())
+				})
+
+				it("uses the defaults", func() {
+					config, ok, err := railsassets.ParseWebpackerConfig(workingDir, lock)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(ok).To(BeTrue())
+					Expect(config).To(Equal(railsassets.WebpackerConfig{
+						Gem:              "shakapacker",
+						ConfigPath:       filepath.Join("config", "webpacker.yml"),
+						PublicRootPath:   "public",
+						PublicOutputPath: filepath.Join("public", "packs"),
+						CachePath:        filepath.Join("tmp", "shakapacker"),
+					}))
+				})
+			})
+		})
+
+		context("when the app uses webpacker", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "config", "webpacker.yml"), []byte(`
+default: &default
+  public_output_path: packs
+
+production:
+  <<: *default
+`), 0600)).To(Succeed())
+			})
+
+			it("reads the production settings", func() {
+				config, ok, err := railsassets.ParseWebpackerConfig(workingDir, railsassets.GemfileLock{Gems: map[string]string{"webpacker": "5.4.4"}})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ok).To(BeTrue())
+				Expect(config).To(Equal(railsassets.WebpackerConfig{
+					Gem:              "webpacker",
+					ConfigPath:       filepath.Join("config", "webpacker.yml"),
+					PublicRootPath:   "public",
+					PublicOutputPath: filepath.Join("public", "packs"),
+					CachePath:        filepath.Join("tmp", "cache", "webpacker"),
+				}))
+			})
+		})
+
+		context("when the app uses neither gem", func() {
+			it("returns false", func() {
+				_, ok, err := railsassets.ParseWebpackerConfig(workingDir, railsassets.GemfileLock{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ok).To(BeFalse())
+			})
+		})
+
+		context("failure cases", func() {
+			context("when the config file cannot be parsed", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "config", "webpacker.yml"), []byte("production: ["), 0600)).To(Succeed())
+				})
+
+				it("returns an error", func() {
+					_, _, err := railsassets.ParseWebpackerConfig(workingDir, railsassets.GemfileLock{Gems: map[string]string{"webpacker": "5.4.4"}})
+					Expect(err).To(MatchError(ContainSubstring("failed to parse config/webpacker.yml")))
+				})
+			})
+		})
+	})
+}